@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Значения по умолчанию для DefaultTokenConfig
+const (
+	DefaultIssuer         = "yandexlms-calculator"
+	DefaultAudience       = "yandexlms-calculator-api"
+	DefaultLeeway         = 30 * time.Second
+	DefaultAccessTokenTTL = 15 * time.Minute
+)
+
+// ErrInvalidClaims — токен подписан верно, но без обязательных claims
+var ErrInvalidClaims = errors.New("token has missing or malformed claims")
+
+// Claims — claims access-токена: sub — ID пользователя, jti — ID токена для отзыва
+type Claims struct {
+	jwt.RegisteredClaims
+}
+
+// UserID — ID пользователя из sub
+func (c *Claims) UserID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 0)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("%w: invalid subject %q", ErrInvalidClaims, c.Subject)
+	}
+	return uint(id), nil
+}
+
+// TokenConfig — параметры выдачи и проверки access-токенов
+type TokenConfig struct {
+	Issuer    string        // iss выдаваемых и ожидаемый iss проверяемых токенов
+	Audience  string        // aud, то же
+	Leeway    time.Duration // допустимое расхождение часов при проверке exp, nbf и iat
+	AccessTTL time.Duration // срок действия access-токена
+}
+
+// DefaultTokenConfig — значения по умолчанию для TokenConfigFromEnv
+var DefaultTokenConfig = TokenConfig{
+	Issuer:    DefaultIssuer,
+	Audience:  DefaultAudience,
+	Leeway:    DefaultLeeway,
+	AccessTTL: DefaultAccessTokenTTL,
+}
+
+// Tokens — параметры access-токенов сервера; RunServer заменяет их настроенными из окружения
+var Tokens = DefaultTokenConfig
+
+// TokenConfigFromEnv — JWT_ISSUER, JWT_AUDIENCE, JWT_LEEWAY и ACCESS_TOKEN_TTL
+// (длительности в формате time.ParseDuration: 30s, 15m)
+func TokenConfigFromEnv() TokenConfig {
+	config := DefaultTokenConfig
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		config.Issuer = issuer
+	}
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		config.Audience = audience
+	}
+	config.Leeway = DurationFromEnv("JWT_LEEWAY", config.Leeway)
+	config.AccessTTL = DurationFromEnv("ACCESS_TOKEN_TTL", config.AccessTTL)
+	return config
+}
+
+// DurationFromEnv — длительность из переменной окружения; fallback, если она не задана или некорректна
+func DurationFromEnv(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d >= 0 {
+		return d
+	}
+	return fallback
+}
+
+// NewAccessToken — подписанный активным ключом access-токен пользователя
+func NewAccessToken(userID uint) (string, *Claims, error) {
+	config := Tokens
+	now := time.Now()
+	claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    config.Issuer,
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		Audience:  jwt.ClaimStrings{config.Audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(config.AccessTTL)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        uuid.New().String(),
+	}}
+
+	token, err := Keys.Sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+// ParseAccessToken — проверка подписи, iss, aud, exp, nbf и iat (с допуском
+// на расхождение часов) и наличия sub и jti
+func ParseAccessToken(tokenString string) (*Claims, error) {
+	config := Tokens
+	claims := new(Claims)
+	_, err := jwt.ParseWithClaims(tokenString, claims, Keys.Keyfunc,
+		jwt.WithValidMethods(Keys.Methods()),
+		jwt.WithIssuer(config.Issuer),
+		jwt.WithAudience(config.Audience),
+		jwt.WithLeeway(config.Leeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Библиотека проверяет nbf и iat, только если они есть; мы их всегда выдаём
+	if claims.NotBefore == nil || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: nbf and iat are required", ErrInvalidClaims)
+	}
+	// Без jti токен нельзя отозвать
+	if claims.ID == "" {
+		return nil, fmt.Errorf("%w: jti is required", ErrInvalidClaims)
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,116 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func useTestKey(t *testing.T) {
+	m := auth.NewKeyManager()
+	secret := []byte(strings.Repeat("k", 32))
+	m.Add(&auth.Key{ID: auth.DefaultKeyID, Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret})
+	if err := m.SetActive(auth.DefaultKeyID); err != nil {
+		t.Fatal(err)
+	}
+	previous := auth.Keys
+	auth.Keys = m
+	t.Cleanup(func() { auth.Keys = previous })
+}
+
+func TestAccessTokenRoundTrip(t *testing.T) {
+	useTestKey(t)
+
+	token, issued, err := auth.NewAccessToken(42)
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+	claims, err := auth.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	id, err := claims.UserID()
+	if err != nil || id != 42 {
+		t.Fatalf("expected user 42, got %d (%v)", id, err)
+	}
+	if claims.ID != issued.ID || claims.Issuer != auth.DefaultIssuer {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestAccessTokenClaimsValidation(t *testing.T) {
+	useTestKey(t)
+	previous := auth.Tokens
+	auth.Tokens.Leeway = 30 * time.Second
+	t.Cleanup(func() { auth.Tokens = previous })
+	now := time.Now()
+
+	valid := func() jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    auth.DefaultIssuer,
+			Subject:   "1",
+			Audience:  jwt.ClaimStrings{auth.DefaultAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        "jti",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *jwt.RegisteredClaims)
+		ok     bool
+	}{
+		{"valid", func(c *jwt.RegisteredClaims) {}, true},
+		{"wrong issuer", func(c *jwt.RegisteredClaims) { c.Issuer = "someone-else" }, false},
+		{"wrong audience", func(c *jwt.RegisteredClaims) { c.Audience = jwt.ClaimStrings{"other-api"} }, false},
+		{"expired", func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) }, false},
+		{"expired within leeway", func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second)) }, true},
+		{"not yet valid", func(c *jwt.RegisteredClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute)) }, false},
+		{"nbf within leeway", func(c *jwt.RegisteredClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(10 * time.Second)) }, true},
+		{"issued in future", func(c *jwt.RegisteredClaims) { c.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute)) }, false},
+		{"no exp", func(c *jwt.RegisteredClaims) { c.ExpiresAt = nil }, false},
+		{"no nbf", func(c *jwt.RegisteredClaims) { c.NotBefore = nil }, false},
+		{"no iat", func(c *jwt.RegisteredClaims) { c.IssuedAt = nil }, false},
+		{"no jti", func(c *jwt.RegisteredClaims) { c.ID = "" }, false},
+		{"bad subject", func(c *jwt.RegisteredClaims) { c.Subject = "admin" }, false},
+	}
+
+	for _, tt := range tests {
+		claims := valid()
+		tt.modify(&claims)
+		token, err := auth.Keys.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = auth.ParseAccessToken(token)
+		if tt.ok && err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if !tt.ok && err == nil {
+			t.Fatalf("%s: token accepted", tt.name)
+		}
+	}
+}
+
+func TestTokenConfigFromEnv(t *testing.T) {
+	useTestKey(t)
+	t.Setenv("JWT_ISSUER", "other-issuer")
+	t.Setenv("JWT_LEEWAY", "soon")
+
+	config := auth.TokenConfigFromEnv()
+	if config.Issuer != "other-issuer" || config.Audience != auth.DefaultAudience || config.Leeway != auth.DefaultLeeway {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+
+	// Окружение читается один раз при запуске: выдача и проверка токенов
+	// пользуются auth.Tokens, а не текущими переменными
+	_, claims, err := auth.NewAccessToken(1)
+	if err != nil || claims.Issuer != auth.Tokens.Issuer {
+		t.Fatalf("expected issuer %q, got %+v (%v)", auth.Tokens.Issuer, claims, err)
+	}
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Алгоритмы хеширования паролей
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// ErrUnknownHash — хеш в БД не распознан ни одним алгоритмом
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Argon2Params — параметры argon2id (RFC 9106)
+type Argon2Params struct {
+	Time    uint32 // число проходов
+	Memory  uint32 // память, КиБ
+	Threads uint8  // параллелизм
+	KeyLen  uint32 // длина хеша, байт
+	SaltLen uint32 // длина соли, байт
+}
+
+// PasswordHasher — хеширование паролей настроенным алгоритмом и проверка
+// хешей любого поддерживаемого алгоритма, в том числе выданных с прежними настройками
+type PasswordHasher struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// DefaultPasswordHasher — значения по умолчанию для PasswordHasherFromEnv
+var DefaultPasswordHasher = PasswordHasher{
+	Algorithm:  AlgorithmBcrypt,
+	BcryptCost: bcrypt.DefaultCost,
+	Argon2:     Argon2Params{Time: 1, Memory: 64 * 1024, Threads: 4, KeyLen: 32, SaltLen: 16},
+}
+
+// Passwords — хешер паролей сервера; RunServer заменяет его настроенным из окружения
+var Passwords = DefaultPasswordHasher
+
+// PasswordHasherFromEnv — PASSWORD_HASH (bcrypt или argon2id), BCRYPT_COST,
+// ARGON2_TIME, ARGON2_MEMORY (КиБ) и ARGON2_THREADS
+func PasswordHasherFromEnv() (PasswordHasher, error) {
+	hasher := DefaultPasswordHasher
+	switch algorithm := os.Getenv("PASSWORD_HASH"); algorithm {
+	case "":
+	case AlgorithmBcrypt, AlgorithmArgon2id:
+		hasher.Algorithm = algorithm
+	default:
+		return hasher, fmt.Errorf("unknown password hash algorithm %q", algorithm)
+	}
+	if n, err := strconv.Atoi(os.Getenv("BCRYPT_COST")); err == nil && n >= bcrypt.MinCost && n <= bcrypt.MaxCost {
+		hasher.BcryptCost = n
+	}
+	if n, err := strconv.ParseUint(os.Getenv("ARGON2_TIME"), 10, 32); err == nil && n > 0 {
+		hasher.Argon2.Time = uint32(n)
+	}
+	if n, err := strconv.ParseUint(os.Getenv("ARGON2_MEMORY"), 10, 32); err == nil && n >= 8 {
+		hasher.Argon2.Memory = uint32(n)
+	}
+	if n, err := strconv.ParseUint(os.Getenv("ARGON2_THREADS"), 10, 8); err == nil && n > 0 {
+		hasher.Argon2.Threads = uint8(n)
+	}
+	return hasher, nil
+}
+
+// Hash — хеш пароля настроенным алгоритмом. Для argon2id — строка в формате PHC:
+// $argon2id$v=19$m=65536,t=1,p=4$<соль>$<хеш>
+func (h PasswordHasher) Hash(password string) (string, error) {
+	if h.Algorithm == AlgorithmArgon2id {
+		salt := make([]byte, h.Argon2.SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		p := h.Argon2
+		key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Time, p.Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+	return string(hash), err
+}
+
+// HashLike — хеш пароля тем же алгоритмом и с теми же параметрами, что у sample;
+// если sample не распознан — настроенными
+func (h PasswordHasher) HashLike(sample, password string) (string, error) {
+	like := h
+	if strings.HasPrefix(sample, "$argon2id$") {
+		if p, _, _, err := parseArgon2(sample); err == nil {
+			like.Algorithm, like.Argon2 = AlgorithmArgon2id, p
+		}
+	} else if cost, err := bcrypt.Cost([]byte(sample)); err == nil {
+		like.Algorithm, like.BcryptCost = AlgorithmBcrypt, cost
+	}
+	return like.Hash(password)
+}
+
+// Verify — совпадает ли пароль с хешем. rehash — хеш получен другим алгоритмом
+// или с другими параметрами, и после успешного входа пароль стоит перехешировать.
+func (h PasswordHasher) Verify(hash, password string) (ok, rehash bool, err error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		stored, salt, key, err := parseArgon2(hash)
+		if err != nil {
+			return false, false, err
+		}
+		computed := argon2.IDKey([]byte(password), salt, stored.Time, stored.Memory, stored.Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return false, false, nil
+		}
+		current := h.Argon2
+		rehash = h.Algorithm != AlgorithmArgon2id || stored.Time != current.Time ||
+			stored.Memory != current.Memory || stored.Threads != current.Threads ||
+			stored.KeyLen != current.KeyLen || stored.SaltLen != current.SaltLen
+		return true, rehash, nil
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, false, ErrUnknownHash
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, h.Algorithm != AlgorithmBcrypt || cost != h.BcryptCost, nil
+}
+
+// parseArgon2 — параметры, соль и хеш из строки PHC
+func parseArgon2(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrUnknownHash
+	}
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads)
+	if err != nil || p.Time == 0 || p.Threads == 0 {
+		return p, nil, nil, ErrUnknownHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrUnknownHash
+	}
+	p.SaltLen, p.KeyLen = uint32(len(salt)), uint32(len(key))
+	return p, salt, key, nil
+}
@@ -0,0 +1,367 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultKeyID — kid ключа из JWT_SECRET, а также ключа для токенов без kid
+const DefaultKeyID = "default"
+
+// minHMACSecret — минимальная длина HMAC-секрета из файла, байт (RFC 7518, 3.2)
+const minHMACSecret = 32
+
+// Key — ключ подписи и проверки JWT
+type Key struct {
+	ID        string            // kid в заголовке токена
+	Method    jwt.SigningMethod // алгоритм; токен другим алгоритмом этим ключом не проверяется
+	SignKey   interface{}       // ключ подписи; nil — ключ только для проверки (выведенный из ротации)
+	VerifyKey interface{}       // ключ проверки; для HMAC — тот же секрет
+}
+
+// KeyManager — набор ключей: активным подписываются новые токены,
+// остальными проверяются токены, выданные до ротации
+type KeyManager struct {
+	mu     sync.RWMutex
+	keys   map[string]*Key
+	active string
+}
+
+// Keys — ключи сервера; заполняется LoadKeys при запуске
+var Keys *KeyManager
+
+// NewKeyManager — пустой набор ключей
+func NewKeyManager() *KeyManager {
+	return &KeyManager{keys: make(map[string]*Key)}
+}
+
+// Add — добавление ключа (или замена ключа с тем же kid)
+func (m *KeyManager) Add(key *Key) error {
+	if key.ID == "" {
+		return errors.New("key id is empty")
+	}
+	if key.Method == nil || key.VerifyKey == nil {
+		return fmt.Errorf("key %q has no method or verification key", key.ID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[key.ID] = key
+	return nil
+}
+
+// SetActive — выбор ключа для подписи новых токенов
+func (m *KeyManager) SetActive(kid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[kid]
+	if !ok {
+		return fmt.Errorf("unknown key id %q", kid)
+	}
+	if key.SignKey == nil {
+		return fmt.Errorf("key %q has no private part and cannot sign", kid)
+	}
+	m.active = kid
+	return nil
+}
+
+// Sign — подпись claims активным ключом, с его kid в заголовке
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	key, ok := m.keys[m.active]
+	m.mu.RUnlock()
+	if !ok {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.SignKey)
+}
+
+// Keyfunc — ключ проверки по kid токена для jwt.Parse. Алгоритм токена
+// должен совпадать с алгоритмом ключа: иначе открытый RSA-ключ можно было
+// бы выдать за HMAC-секрет.
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = DefaultKeyID
+	}
+
+	m.mu.RLock()
+	key, ok := m.keys[kid]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v for key %q", token.Header["alg"], kid)
+	}
+	return key.VerifyKey, nil
+}
+
+// Methods — алгоритмы загруженных ключей, для jwt.WithValidMethods
+func (m *KeyManager) Methods() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	seen := make(map[string]bool)
+	var methods []string
+	for _, key := range m.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// replace — подмена набора ключей целиком (перечитывание каталога без перезапуска)
+func (m *KeyManager) replace(other *KeyManager) {
+	other.mu.RLock()
+	keys, active := other.keys, other.active
+	other.mu.RUnlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys, m.active = keys, active
+}
+
+// LoadKeys — загрузка ключей сервера в Keys. Если задан JWT_KEYS_DIR,
+// ключи читаются из каталога (см. LoadKeyDir), активный — JWT_ACTIVE_KID
+// или файл active каталога; иначе единственный HS256-ключ — JWT_SECRET.
+// Повторный вызов подменяет ключи на месте: так ротация проходит без перезапуска.
+func LoadKeys() error {
+	var m *KeyManager
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		var err error
+		if m, err = LoadKeyDir(dir, os.Getenv("JWT_ACTIVE_KID")); err != nil {
+			return err
+		}
+	} else {
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			return errors.New("neither JWT_KEYS_DIR nor JWT_SECRET is set")
+		}
+		m = NewKeyManager()
+		m.Add(&Key{ID: DefaultKeyID, Method: jwt.SigningMethodHS256, SignKey: []byte(secret), VerifyKey: []byte(secret)})
+		m.SetActive(DefaultKeyID)
+	}
+
+	if Keys == nil {
+		Keys = m
+	} else {
+		Keys.replace(m)
+	}
+	return nil
+}
+
+// LoadKeyDir — ключи из каталога; kid — имя файла без расширения:
+//
+//	<kid>.pem  — закрытый ключ PEM (PKCS#8, PKCS#1 или SEC1): RSA — RS256,
+//	             ECDSA P-256/P-384/P-521 — ES256/ES384/ES512, Ed25519 — EdDSA;
+//	             либо открытый ключ (PUBLIC KEY) — только для проверки
+//	<kid>.hmac — секрет HS256 не короче 32 байт
+//
+// active — kid ключа подписи; если пуст — берётся из файла active каталога,
+// а без него допустим только один ключ, которым можно подписывать.
+func LoadKeyDir(dir, active string) (*KeyManager, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read keys dir: %w", err)
+	}
+
+	m := NewKeyManager()
+	var signers []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		if ext != ".pem" && ext != ".hmac" {
+			continue
+		}
+
+		kid := strings.TrimSuffix(entry.Name(), ext)
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var key *Key
+		if ext == ".pem" {
+			key, err = parsePEMKey(kid, data)
+		} else {
+			key, err = parseHMACKey(kid, data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", entry.Name(), err)
+		}
+		if err := m.Add(key); err != nil {
+			return nil, err
+		}
+		if key.SignKey != nil {
+			signers = append(signers, kid)
+		}
+	}
+
+	// Файл active можно поменять на месте — в отличие от переменной окружения,
+	// он перечитывается вместе с ключами
+	if active == "" {
+		if data, err := os.ReadFile(filepath.Join(dir, "active")); err == nil {
+			active = strings.TrimSpace(string(data))
+		}
+	}
+	if active == "" {
+		if len(signers) != 1 {
+			return nil, fmt.Errorf("%d signing keys in %s, set JWT_ACTIVE_KID or the active file", len(signers), dir)
+		}
+		active = signers[0]
+	}
+	if err := m.SetActive(active); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func parseHMACKey(kid string, data []byte) (*Key, error) {
+	secret := []byte(strings.TrimSpace(string(data)))
+	if len(secret) < minHMACSecret {
+		return nil, fmt.Errorf("HMAC secret must be at least %d bytes", minHMACSecret)
+	}
+	return &Key{ID: kid, Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret}, nil
+}
+
+func parsePEMKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var private, public interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if private != nil {
+		switch k := private.(type) {
+		case *rsa.PrivateKey:
+			public = &k.PublicKey
+		case *ecdsa.PrivateKey:
+			public = &k.PublicKey
+		case ed25519.PrivateKey:
+			public = k.Public()
+		default:
+			return nil, fmt.Errorf("unsupported private key type %T", private)
+		}
+	}
+
+	method, err := methodFor(public)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{ID: kid, Method: method, SignKey: private, VerifyKey: public}, nil
+}
+
+// methodFor — алгоритм подписи по типу открытого ключа
+func methodFor(public interface{}) (jwt.SigningMethod, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		}
+		return nil, fmt.Errorf("unsupported curve %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", public)
+}
+
+// JWK — открытый ключ в формате JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet — ответ JWKS-эндпоинта
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS — открытые ключи для проверки токенов другими сервисами.
+// HMAC-ключи секретны и не публикуются.
+func (m *KeyManager) JWKS() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range m.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch k := key.VerifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encodeBase64(k.N.Bytes())
+			jwk.E = encodeBase64(big.NewInt(int64(k.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (k.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = k.Curve.Params().Name
+			jwk.X = encodeBase64(k.X.FillBytes(make([]byte, size)))
+			jwk.Y = encodeBase64(k.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = encodeBase64(k)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+func encodeBase64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
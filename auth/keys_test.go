@@ -0,0 +1,175 @@
+package auth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKeys — каталог с ключами всех поддерживаемых видов
+func writeKeys(t *testing.T) (string, *rsa.PrivateKey) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "rsa-2024.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "ec-2025.pem"), "PRIVATE KEY", ecDER)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "ed-2026.pem"), "PRIVATE KEY", edDER)
+
+	// Выведенный из ротации ключ: остался только открытый
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDER, err := x509.MarshalPKIXPublicKey(&oldKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "rsa-2023.pem"), "PUBLIC KEY", oldDER)
+
+	secret := strings.Repeat("s", 32)
+	if err := os.WriteFile(filepath.Join(dir, "hmac.hmac"), []byte(secret+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir, rsaKey
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func parse(m *auth.KeyManager, token string) error {
+	_, err := jwt.Parse(token, m.Keyfunc, jwt.WithValidMethods(m.Methods()))
+	return err
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir, _ := writeKeys(t)
+
+	if _, err := auth.LoadKeyDir(dir, ""); err == nil {
+		t.Fatal("several signing keys without active kid must be rejected")
+	}
+	if _, err := auth.LoadKeyDir(dir, "rsa-2023"); err == nil {
+		t.Fatal("public-only key must not become active")
+	}
+
+	// Активный ключ из файла active
+	if err := os.WriteFile(filepath.Join(dir, "active"), []byte("ec-2025\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m, err := auth.LoadKeyDir(dir, "")
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+	claims := jwt.MapClaims{"sub": 1, "exp": time.Now().Add(time.Minute).Unix()}
+
+	tokens := make(map[string]string)
+	for _, kid := range []string{"rsa-2024", "ec-2025", "ed-2026", "hmac"} {
+		if err := m.SetActive(kid); err != nil {
+			t.Fatalf("activate %s: %v", kid, err)
+		}
+		token, err := m.Sign(claims)
+		if err != nil {
+			t.Fatalf("sign with %s: %v", kid, err)
+		}
+		tokens[kid] = token
+	}
+
+	// После ротации токены, подписанные прежними ключами, остаются действительными
+	for kid, token := range tokens {
+		if err := parse(m, token); err != nil {
+			t.Fatalf("token signed by %s rejected: %v", kid, err)
+		}
+	}
+
+	// Токен с неизвестным kid не принимается
+	other := auth.NewKeyManager()
+	other.Add(&auth.Key{ID: "unknown", Method: jwt.SigningMethodHS256, SignKey: []byte("x"), VerifyKey: []byte("x")})
+	other.SetActive("unknown")
+	token, _ := other.Sign(claims)
+	if err := parse(m, token); err == nil {
+		t.Fatal("token with unknown kid accepted")
+	}
+}
+
+func TestKeyAlgorithmConfusion(t *testing.T) {
+	dir, rsaKey := writeKeys(t)
+	m, err := auth.LoadKeyDir(dir, "rsa-2024")
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+
+	// HS256-токен, «подписанный» открытым RSA-ключом, с kid RSA-ключа
+	public, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": 1})
+	token.Header["kid"] = "rsa-2024"
+	forged, err := token.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parse(m, forged); err == nil {
+		t.Fatal("HS256 token verified with RSA key")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	dir, _ := writeKeys(t)
+	m, err := auth.LoadKeyDir(dir, "ed-2026")
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+
+	expected := map[string]string{
+		"ec-2025":  "EC",
+		"ed-2026":  "OKP",
+		"rsa-2023": "RSA",
+		"rsa-2024": "RSA",
+	}
+	set := m.JWKS()
+	if len(set.Keys) != len(expected) {
+		t.Fatalf("expected %d public keys (HMAC excluded), got %d", len(expected), len(set.Keys))
+	}
+	for _, key := range set.Keys {
+		if expected[key.Kid] != key.Kty {
+			t.Fatalf("key %s: expected kty %s, got %s", key.Kid, expected[key.Kid], key.Kty)
+		}
+		if key.Kty == "EC" && (key.Crv != "P-256" || len(key.X) != 43 || len(key.Y) != 43) {
+			t.Fatalf("malformed EC key: %+v", key)
+		}
+	}
+}
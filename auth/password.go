@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ошибки проверки пароля по политике
+var (
+	ErrPasswordTooShort  = errors.New("password is too short")
+	ErrPasswordTooLong   = errors.New("password is too long")
+	ErrPasswordTooSimple = errors.New("password uses too few character classes")
+	ErrPasswordCommon    = errors.New("password is too common")
+)
+
+// bcryptMaxBytes — bcrypt учитывает только первые 72 байта пароля
+const bcryptMaxBytes = 72
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// PasswordPolicy — требования к новому паролю
+type PasswordPolicy struct {
+	MinLength  int                 // минимум символов
+	MaxLength  int                 // максимум байт; для bcrypt не больше 72
+	MinClasses int                 // минимум классов символов: строчные, заглавные, цифры, прочие
+	Blocklist  map[string]struct{} // распространённые и утёкшие пароли в нижнем регистре
+}
+
+// DefaultPasswordPolicy — значения по умолчанию для PasswordPolicyFromEnv
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:  8,
+	MaxLength:  bcryptMaxBytes,
+	MinClasses: 2,
+	Blocklist:  loadBlocklist(strings.NewReader(commonPasswords)),
+}
+
+// Policy — политика паролей сервера; RunServer заменяет её настроенной из окружения
+var Policy = DefaultPasswordPolicy
+
+// PasswordPolicyFromEnv — PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH, PASSWORD_MIN_CLASSES
+// и PASSWORD_BLOCKLIST_FILE (по паролю на строке, дополняет встроенный список).
+// Для bcrypt максимальная длина не превышает 72 байт, чтобы хвост пароля не отбрасывался молча.
+func PasswordPolicyFromEnv(hasher PasswordHasher) (PasswordPolicy, error) {
+	policy := DefaultPasswordPolicy
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && n > 0 {
+		policy.MinLength = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MAX_LENGTH")); err == nil && n > 0 {
+		policy.MaxLength = n
+	}
+	if hasher.Algorithm == AlgorithmBcrypt && policy.MaxLength > bcryptMaxBytes {
+		policy.MaxLength = bcryptMaxBytes
+	}
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_CLASSES")); err == nil && n >= 0 && n <= 4 {
+		policy.MinClasses = n
+	}
+
+	if path := os.Getenv("PASSWORD_BLOCKLIST_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return policy, fmt.Errorf("blocklist: %w", err)
+		}
+		defer file.Close()
+		extra := loadBlocklist(file)
+		policy.Blocklist = make(map[string]struct{}, len(DefaultPasswordPolicy.Blocklist)+len(extra))
+		for _, set := range []map[string]struct{}{DefaultPasswordPolicy.Blocklist, extra} {
+			for password := range set {
+				policy.Blocklist[password] = struct{}{}
+			}
+		}
+	}
+	return policy, nil
+}
+
+// Validate — проверка нового пароля; пароль, совпадающий с логином, тоже считается распространённым
+func (p PasswordPolicy) Validate(login, password string) error {
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		return fmt.Errorf("%w: at least %d characters required", ErrPasswordTooShort, p.MinLength)
+	}
+	if len(password) > p.MaxLength {
+		return fmt.Errorf("%w: at most %d bytes allowed", ErrPasswordTooLong, p.MaxLength)
+	}
+	if n := characterClasses(password); n < p.MinClasses {
+		return fmt.Errorf("%w: at least %d of lowercase, uppercase, digits and symbols required", ErrPasswordTooSimple, p.MinClasses)
+	}
+
+	lower := strings.ToLower(password)
+	if _, ok := p.Blocklist[lower]; ok || lower == strings.ToLower(login) {
+		return ErrPasswordCommon
+	}
+	return nil
+}
+
+// characterClasses — сколько классов символов встречается в пароле
+func characterClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	n := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			n++
+		}
+	}
+	return n
+}
+
+// loadBlocklist — пароли по одному на строке; пустые строки и комментарии (#) пропускаются
+func loadBlocklist(r io.Reader) map[string]struct{} {
+	set := make(map[string]struct{})
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[strings.ToLower(line)] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,126 @@
+package auth_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	blocklist := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(blocklist, []byte("# утечка\nCorrectHorse9\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PASSWORD_BLOCKLIST_FILE", blocklist)
+	t.Setenv("PASSWORD_MAX_LENGTH", "200")
+	policy, err := auth.PasswordPolicyFromEnv(auth.DefaultPasswordHasher)
+	if err != nil {
+		t.Fatalf("load policy: %v", err)
+	}
+	if policy.MaxLength != 72 {
+		t.Fatalf("bcrypt policy must cap length at 72 bytes, got %d", policy.MaxLength)
+	}
+
+	tests := []struct {
+		password string
+		err      error
+	}{
+		{"s3cure-enough", nil},
+		{"Пароль-2024", nil},
+		{"short1", auth.ErrPasswordTooShort},
+		{strings.Repeat("ab1", 25), auth.ErrPasswordTooLong},
+		{strings.Repeat("я", 37), auth.ErrPasswordTooLong}, // 37 символов, но 74 байта
+		{"onlylowercase", auth.ErrPasswordTooSimple},
+		{"Password123", auth.ErrPasswordCommon},
+		{"correcthorse9", auth.ErrPasswordCommon},
+		{"Alice-2024", auth.ErrPasswordCommon}, // совпадает с логином
+	}
+	for _, tt := range tests {
+		err := policy.Validate("alice-2024", tt.password)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("%q: expected %v, got %v", tt.password, tt.err, err)
+		}
+	}
+}
+
+func TestPasswordRehash(t *testing.T) {
+	old := auth.DefaultPasswordHasher
+	old.BcryptCost = bcrypt.MinCost
+	hash, err := old.Hash("s3cure-enough")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Та же стоимость — перехеширование не нужно
+	if ok, rehash, err := old.Verify(hash, "s3cure-enough"); !ok || rehash || err != nil {
+		t.Fatalf("verify: ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+	if ok, _, _ := old.Verify(hash, "wrong"); ok {
+		t.Fatal("wrong password accepted")
+	}
+
+	// Смена алгоритма: bcrypt-хеш по-прежнему проверяется, но требует перехеширования
+	current := auth.DefaultPasswordHasher
+	current.Algorithm = auth.AlgorithmArgon2id
+	current.Argon2.Memory = 1024
+	if ok, rehash, err := current.Verify(hash, "s3cure-enough"); !ok || !rehash || err != nil {
+		t.Fatalf("bcrypt hash under argon2id: ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+
+	migrated, err := current.Hash("s3cure-enough")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(migrated, "$argon2id$v=19$m=1024,t=1,p=4$") {
+		t.Fatalf("unexpected argon2id hash: %s", migrated)
+	}
+	if ok, rehash, err := current.Verify(migrated, "s3cure-enough"); !ok || rehash || err != nil {
+		t.Fatalf("argon2id verify: ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+	if ok, _, _ := current.Verify(migrated, "wrong"); ok {
+		t.Fatal("wrong password accepted by argon2id")
+	}
+
+	// Изменились параметры argon2id
+	current.Argon2.Time = 2
+	if _, rehash, _ := current.Verify(migrated, "s3cure-enough"); !rehash {
+		t.Fatal("changed argon2id parameters must trigger rehash")
+	}
+
+	if _, _, err := current.Verify("plaintext", "plaintext"); !errors.Is(err, auth.ErrUnknownHash) {
+		t.Fatalf("expected ErrUnknownHash, got %v", err)
+	}
+}
+
+func TestPasswordHashLike(t *testing.T) {
+	current := auth.DefaultPasswordHasher
+	current.Algorithm = auth.AlgorithmArgon2id
+	current.Argon2.Memory = 1024
+
+	// Заглушка повторяет формат образца, а не текущие настройки
+	old := auth.DefaultPasswordHasher
+	old.BcryptCost = bcrypt.MinCost
+	sample, _ := old.Hash("sample")
+	hash, err := current.HashLike(sample, "dummy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost, err := bcrypt.Cost([]byte(hash)); err != nil || cost != bcrypt.MinCost {
+		t.Fatalf("expected bcrypt hash with cost %d, got %s", bcrypt.MinCost, hash)
+	}
+
+	sample, _ = current.Hash("sample")
+	if hash, _ := old.HashLike(sample, "dummy"); !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=4$") {
+		t.Fatalf("expected argon2id hash with sample parameters, got %s", hash)
+	}
+
+	// Без образца — настроенный алгоритм
+	if hash, _ := current.HashLike("", "dummy"); !strings.HasPrefix(hash, "$argon2id$") {
+		t.Fatalf("expected configured algorithm, got %s", hash)
+	}
+}
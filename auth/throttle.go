@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ThrottleConfig — ограничение неудачных попыток входа
+type ThrottleConfig struct {
+	Window             time.Duration // скользящее окно, в котором считаются неудачные попытки
+	MaxAccountFailures int           // неудач на учётную запись до блокировки
+	MaxAddressFailures int           // неудач с одного адреса до блокировки
+	Backoff            time.Duration // пауза после первой неудачи; дальше удваивается
+	MaxBackoff         time.Duration // предел паузы между попытками
+	Lockout            time.Duration // срок временной блокировки
+}
+
+// DefaultThrottleConfig — значения по умолчанию для ThrottleConfigFromEnv
+var DefaultThrottleConfig = ThrottleConfig{
+	Window:             15 * time.Minute,
+	MaxAccountFailures: 5,
+	MaxAddressFailures: 50,
+	Backoff:            time.Second,
+	MaxBackoff:         30 * time.Second,
+	Lockout:            15 * time.Minute,
+}
+
+// ThrottleConfigFromEnv — LOGIN_WINDOW, LOGIN_MAX_FAILURES, LOGIN_MAX_FAILURES_PER_IP,
+// LOGIN_BACKOFF, LOGIN_MAX_BACKOFF и LOGIN_LOCKOUT; некорректные значения заменяются значениями по умолчанию
+func ThrottleConfigFromEnv() ThrottleConfig {
+	config := DefaultThrottleConfig
+	config.Window = DurationFromEnv("LOGIN_WINDOW", config.Window)
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_MAX_FAILURES")); err == nil && n > 0 {
+		config.MaxAccountFailures = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_MAX_FAILURES_PER_IP")); err == nil && n > 0 {
+		config.MaxAddressFailures = n
+	}
+	config.Backoff = DurationFromEnv("LOGIN_BACKOFF", config.Backoff)
+	config.MaxBackoff = DurationFromEnv("LOGIN_MAX_BACKOFF", config.MaxBackoff)
+	config.Lockout = DurationFromEnv("LOGIN_LOCKOUT", config.Lockout)
+	return config
+}
+
+// Logins — счётчик попыток входа сервера; RunServer заменяет его настроенным из окружения
+var Logins = NewLoginThrottle(DefaultThrottleConfig)
+
+// LoginThrottle — учёт неудачных попыток входа по учётной записи и по адресу клиента.
+// Счётчики хранятся в памяти процесса: у нескольких экземпляров сервера они свои.
+type LoginThrottle struct {
+	config ThrottleConfig
+	Now    func() time.Time // источник времени; подменяется в тестах
+
+	mu        sync.Mutex
+	accounts  map[string]*attempts
+	addresses map[string]*attempts
+	lastSweep time.Time
+}
+
+// attempts — неудачные попытки одного ключа (логина или адреса) в пределах окна
+// и попытки, пропущенные Check, пароль которых ещё проверяется
+type attempts struct {
+	failures    []time.Time
+	pending     []time.Time
+	lockedUntil time.Time
+}
+
+// reservedWait — пауза, если все попытки до блокировки уже заняты проверяемыми
+const reservedWait = time.Second
+
+// reservationTTL — через сколько незавершённая попытка перестаёт учитываться:
+// запрос, оборвавшийся между Check и Failure, не должен занимать её навсегда
+const reservationTTL = time.Minute
+
+// NewLoginThrottle — пустой счётчик попыток
+func NewLoginThrottle(config ThrottleConfig) *LoginThrottle {
+	return &LoginThrottle{
+		config:    config,
+		Now:       time.Now,
+		accounts:  make(map[string]*attempts),
+		addresses: make(map[string]*attempts),
+	}
+}
+
+// Check — сколько ещё ждать до следующей попытки входа. Учитывается большее
+// из ограничений учётной записи и адреса. 0 — попытка занята: она считается
+// в лимите неудач, пока не завершится Failure, Success или Release, поэтому
+// одновременные запросы не проверят больше паролей, чем разрешено до блокировки.
+func (t *LoginThrottle) Check(login, address string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.Now()
+	t.sweep(now)
+
+	wait := t.wait(t.accounts[login], now)
+	if w := t.wait(t.addresses[address], now); w > wait {
+		wait = w
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	account := t.entry(t.accounts, login)
+	addr := t.entry(t.addresses, address)
+	if t.exhausted(account, t.config.MaxAccountFailures, now) || t.exhausted(addr, t.config.MaxAddressFailures, now) {
+		return reservedWait
+	}
+	account.pending = append(account.pending, now)
+	addr.pending = append(addr.pending, now)
+	return 0
+}
+
+// Failure — учёт неудачи попытки, занятой Check. Возвращает паузу до следующей
+// попытки и признак того, что эта неудача заблокировала учётную запись или адрес.
+func (t *LoginThrottle) Failure(login, address string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.Now()
+	t.release(login, address)
+
+	account := t.record(t.accounts, login, t.config.MaxAccountFailures, now)
+	addr := t.record(t.addresses, address, t.config.MaxAddressFailures, now)
+	locked := account || addr
+
+	wait := t.wait(t.accounts[login], now)
+	if w := t.wait(t.addresses[address], now); w > wait {
+		wait = w
+	}
+	return wait, locked
+}
+
+// Success — сброс счётчика учётной записи после успешного входа. Неудачи адреса
+// не сбрасываются: иначе перебор чужих паролей можно перемежать входом в свою учётную запись.
+func (t *LoginThrottle) Success(login, address string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.release(login, address)
+	delete(t.accounts, login)
+}
+
+// Release — освобождение попытки, занятой Check, если пароль так и не проверили
+// (например, из-за ошибки БД)
+func (t *LoginThrottle) Release(login, address string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.release(login, address)
+}
+
+// release — снятие одной занятой попытки с учётной записи и адреса
+func (t *LoginThrottle) release(login, address string) {
+	for _, a := range []*attempts{t.accounts[login], t.addresses[address]} {
+		if a != nil && len(a.pending) > 0 {
+			a.pending = a.pending[1:]
+		}
+	}
+}
+
+// entry — попытки ключа, созданные при первом обращении
+func (t *LoginThrottle) entry(set map[string]*attempts, key string) *attempts {
+	a := set[key]
+	if a == nil {
+		a = new(attempts)
+		set[key] = a
+	}
+	return a
+}
+
+// exhausted — неудачи вместе с проверяемыми попытками уже достигли блокировки
+func (t *LoginThrottle) exhausted(a *attempts, max int, now time.Time) bool {
+	t.prune(a, now)
+	return len(a.failures)+len(a.pending) >= max
+}
+
+// record — добавление неудачи; true, если она привела к блокировке
+func (t *LoginThrottle) record(set map[string]*attempts, key string, max int, now time.Time) bool {
+	a := t.entry(set, key)
+	t.prune(a, now)
+	a.failures = append(a.failures, now)
+	if len(a.failures) >= max && !now.Before(a.lockedUntil) {
+		a.lockedUntil = now.Add(t.config.Lockout)
+		return true
+	}
+	return false
+}
+
+// wait — пауза для ключа: до конца блокировки или экспоненциальная после последней неудачи
+func (t *LoginThrottle) wait(a *attempts, now time.Time) time.Duration {
+	if a == nil {
+		return 0
+	}
+	if now.Before(a.lockedUntil) {
+		return a.lockedUntil.Sub(now)
+	}
+	t.prune(a, now)
+	n := len(a.failures)
+	if n == 0 {
+		return 0
+	}
+
+	delay := t.config.Backoff
+	for i := 1; i < n && delay < t.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > t.config.MaxBackoff {
+		delay = t.config.MaxBackoff
+	}
+	if wait := a.failures[n-1].Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// prune — удаление неудач, вышедших из окна, и оборвавшихся попыток
+func (t *LoginThrottle) prune(a *attempts, now time.Time) {
+	a.failures = after(a.failures, now.Add(-t.config.Window))
+	a.pending = after(a.pending, now.Add(-reservationTTL))
+}
+
+// after — хвост упорядоченных отметок времени позже cutoff
+func after(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// sweep — раз в окно удаляет ключи без действующих неудач и блокировок,
+// чтобы перебор случайных логинов не раздувал память
+func (t *LoginThrottle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.config.Window {
+		return
+	}
+	t.lastSweep = now
+	for _, set := range []map[string]*attempts{t.accounts, t.addresses} {
+		for key, a := range set {
+			t.prune(a, now)
+			if len(a.failures) == 0 && len(a.pending) == 0 && !now.Before(a.lockedUntil) {
+				delete(set, key)
+			}
+		}
+	}
+}
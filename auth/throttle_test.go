@@ -0,0 +1,144 @@
+package auth_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/auth"
+)
+
+func newThrottle(config auth.ThrottleConfig) (*auth.LoginThrottle, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	t := auth.NewLoginThrottle(config)
+	t.Now = func() time.Time { return now }
+	return t, &now
+}
+
+func TestLoginThrottleBackoffAndLockout(t *testing.T) {
+	throttle, now := newThrottle(auth.DefaultThrottleConfig)
+
+	// Паузы удваиваются после каждой неудачи
+	for i, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second} {
+		if wait := throttle.Check("alice", "10.0.0.1"); wait != 0 {
+			t.Fatalf("attempt %d: unexpected wait %v", i+1, wait)
+		}
+		wait, locked := throttle.Failure("alice", "10.0.0.1")
+		if wait != expected || locked {
+			t.Fatalf("failure %d: expected wait %v, got %v (locked %v)", i+1, expected, wait, locked)
+		}
+		if throttle.Check("alice", "10.0.0.2") == 0 {
+			t.Fatalf("failure %d: account not throttled from another address", i+1)
+		}
+		*now = now.Add(wait)
+	}
+
+	// Пятая неудача блокирует учётную запись
+	if _, locked := throttle.Failure("alice", "10.0.0.1"); !locked {
+		t.Fatal("account not locked after max failures")
+	}
+	*now = now.Add(10 * time.Minute)
+	if wait := throttle.Check("alice", "10.0.0.3"); wait != 5*time.Minute {
+		t.Fatalf("expected 5m of lockout left, got %v", wait)
+	}
+	if wait := throttle.Check("bob", "10.0.0.3"); wait != 0 {
+		t.Fatalf("other account throttled: %v", wait)
+	}
+
+	// После блокировки и выхода неудач из окна счётчик начинается заново
+	*now = now.Add(16 * time.Minute)
+	if wait := throttle.Check("alice", "10.0.0.1"); wait != 0 {
+		t.Fatalf("lockout not expired: %v", wait)
+	}
+	if wait, _ := throttle.Failure("alice", "10.0.0.1"); wait != time.Second {
+		t.Fatalf("expected fresh backoff, got %v", wait)
+	}
+}
+
+func TestLoginThrottleAddress(t *testing.T) {
+	config := auth.DefaultThrottleConfig
+	config.MaxAddressFailures = 3
+	throttle, now := newThrottle(config)
+
+	// Перебор разных логинов с одного адреса
+	for i, login := range []string{"a", "b", "c"} {
+		wait, locked := throttle.Failure(login, "10.0.0.1")
+		if locked != (i == 2) {
+			t.Fatalf("failure %d: locked = %v", i+1, locked)
+		}
+		if !locked {
+			*now = now.Add(wait)
+		}
+	}
+	if throttle.Check("d", "10.0.0.1") == 0 {
+		t.Fatal("address not locked")
+	}
+
+	// Успешный вход сбрасывает учётную запись, но не адрес
+	throttle.Success("a", "10.0.0.1")
+	if throttle.Check("a", "10.0.0.2") != 0 {
+		t.Fatal("account not reset after success")
+	}
+	if throttle.Check("a", "10.0.0.1") == 0 {
+		t.Fatal("address reset after success")
+	}
+}
+
+func TestLoginThrottleConcurrentCheck(t *testing.T) {
+	config := auth.DefaultThrottleConfig
+	config.MaxAddressFailures = 3
+	throttle, now := newThrottle(config)
+
+	// Одновременные попытки к одной учётной записи и с одного адреса: пропускается
+	// не больше, чем осталось до блокировки, сколько бы запросов ни пришло разом
+	concurrent := func(login, address func(i int) string) int {
+		var allowed atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if throttle.Check(login(i), address(i)) == 0 {
+					allowed.Add(1)
+				}
+			}(i)
+		}
+		wg.Wait()
+		return int(allowed.Load())
+	}
+	each := func(prefix string) func(int) string {
+		return func(i int) string { return fmt.Sprintf("%s%d", prefix, i) }
+	}
+	same := func(key string) func(int) string {
+		return func(int) string { return key }
+	}
+
+	if n := concurrent(same("alice"), each("10.0.1.")); n != config.MaxAccountFailures {
+		t.Fatalf("account: expected %d attempts, got %d", config.MaxAccountFailures, n)
+	}
+	if n := concurrent(each("user"), same("10.0.0.1")); n != config.MaxAddressFailures {
+		t.Fatalf("address: expected %d attempts, got %d", config.MaxAddressFailures, n)
+	}
+
+	// Неудачи всех пропущенных попыток блокируют учётную запись
+	locked := false
+	for i := 0; i < config.MaxAccountFailures; i++ {
+		_, l := throttle.Failure("alice", fmt.Sprintf("10.0.1.%d", i))
+		locked = locked || l
+	}
+	if !locked || throttle.Check("alice", "10.0.2.1") == 0 {
+		t.Fatal("account not locked after concurrent failures")
+	}
+
+	// Освобождённая попытка снова доступна, оборвавшиеся истекают сами
+	throttle.Release("user0", "10.0.0.1")
+	if throttle.Check("user50", "10.0.0.1") != 0 {
+		t.Fatal("released attempt not available")
+	}
+	*now = now.Add(2 * time.Minute)
+	if throttle.Check("user51", "10.0.0.1") != 0 {
+		t.Fatal("abandoned attempts not expired")
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/internal/agent"
+	"github.com/Powdersumm/Yandexlmsfinalproject/pkg/calculation"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// Загрузка .env файла (для агента необязательна)
+	if err := godotenv.Load(); err != nil {
+		log.Println("Не найден .env файл")
+	}
+
+	// Флаги имеют приоритет над переменными окружения
+	config := agent.ConfigFromEnv()
+	flag.StringVar(&config.OrchestratorURL, "orchestrator", config.OrchestratorURL, "адрес оркестратора")
+	flag.IntVar(&config.ComputingPower, "workers", config.ComputingPower, "число параллельных вычислителей (COMPUTING_POWER)")
+	flag.StringVar(&config.Evaluator, "evaluator", config.Evaluator, "вычислитель операций: native или govaluate (EVALUATOR)")
+	flag.Parse()
+
+	if config.ComputingPower < 1 {
+		log.Fatal("Число вычислителей должно быть положительным")
+	}
+	if _, err := calculation.LookupEvaluator(config.Evaluator); err != nil {
+		log.Fatal(err)
+	}
+	if config.Token == "" {
+		log.Fatal("Не задан AGENT_TOKEN: оркестратор не выдаёт задачи агентам без общего секрета")
+	}
+
+	// Остановка по SIGINT/SIGTERM: новые задачи не берём, взятые досчитываем
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	agent.New(config).Run(ctx)
+}
@@ -1 +0,0 @@
-Yandexlmsfinalproject/
\ No newline at end of file
@@ -32,7 +32,8 @@ func Connect() error {
 
 	// Включаем расширение для UUID и выполняем миграции
 	db.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"")
-	if err := db.AutoMigrate(&models.User{}, &models.Expression{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.Expression{}, &models.ExpressionTask{},
+		&models.RefreshToken{}, &models.RevokedToken{}); err != nil {
 		return fmt.Errorf("ошибка миграции: %w", err)
 	}
 
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errQueueEmpty = errors.New("queue is empty")
+
+// EnqueueExpression — сохранение выражения и постановка его в очередь одной транзакцией
+func EnqueueExpression(expr *models.Expression) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(expr).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ExpressionTask{
+			ID:                     expr.ID,
+			Expression:             expr.Expression,
+			Variables:              expr.Variables,
+			Mode:                   expr.Mode,
+			Scale:                  expr.Scale,
+			Rounding:               expr.Rounding,
+			UserID:                 expr.UserID,
+			ImplicitMultiplication: expr.ImplicitMultiplication,
+		}).Error
+	})
+	if err == nil {
+		notifyQueued()
+	}
+	return err
+}
+
+// ClaimTask — захват самой старой свободной задачи очереди на время lease; nil,
+// если очередь пуста. Свободна задача без захвата или с истёкшим захватом (экземпляр,
+// захвативший её, упал или завис). Строки, заблокированные другими экземплярами,
+// пропускаются (FOR UPDATE SKIP LOCKED). Задача остаётся в очереди до CompleteExpression.
+func ClaimTask(owner string, lease time.Duration) (*models.ExpressionTask, error) {
+	var task models.ExpressionTask
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("claimed_until IS NULL OR claimed_until < now()").
+			Order("created_at").
+			Limit(1).
+			Find(&task)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errQueueEmpty
+		}
+		return tx.Model(&task).Updates(map[string]interface{}{
+			"claimed_by":    owner,
+			"claimed_until": claimExpiry(lease),
+		}).Error
+	})
+	if errors.Is(err, errQueueEmpty) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Задач может быть больше одной — будим следующего вычислителя
+	notifyQueued()
+	return &task, nil
+}
+
+// ExtendClaims — продление захвата задач, которые этот экземпляр ещё считает.
+// Задачи, захват которых уже перешёл к другому экземпляру, не трогаются.
+func ExtendClaims(owner string, ids []string, lease time.Duration) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return DB.Model(&models.ExpressionTask{}).
+		Where("claimed_by = ? AND id IN ?", owner, ids).
+		Update("claimed_until", claimExpiry(lease)).Error
+}
+
+// ReleaseClaims — освобождение всех задач экземпляра, чтобы их сразу
+// подхватил другой экземпляр, не дожидаясь истечения захвата
+func ReleaseClaims(owner string) (int64, error) {
+	res := DB.Model(&models.ExpressionTask{}).
+		Where("claimed_by = ?", owner).
+		Updates(map[string]interface{}{"claimed_by": "", "claimed_until": nil})
+	if res.RowsAffected > 0 {
+		notifyQueued()
+	}
+	return res.RowsAffected, res.Error
+}
+
+// CompleteExpression — запись итога выражения и удаление его из очереди одной
+// транзакцией. Итог записывается, только если выражение ещё pending: если его
+// досчитали два экземпляра (захват истёк у зависшего), первый результат не затирается.
+// false — выражение уже было завершено.
+func CompleteExpression(id string, updates map[string]interface{}) (bool, error) {
+	var updated bool
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Expression{}).
+			Where("id = ? AND status = ?", id, "pending").
+			Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		updated = res.RowsAffected > 0
+		return tx.Delete(&models.ExpressionTask{}, "id = ?", id).Error
+	})
+	return updated, err
+}
+
+// RecoverPending — постановка в очередь выражений в статусе pending, которых в ней
+// нет (например, захваченных версией, удалявшей задачу из очереди при захвате).
+// Задачи, захваченные работающими экземплярами, остаются за ними.
+func RecoverPending() (int64, error) {
+	res := DB.Exec(`
+		INSERT INTO expression_tasks (id, expression, variables, mode, scale, rounding, implicit_multiplication, user_id, created_at)
+		SELECT id, expression, variables, mode, scale, rounding, implicit_multiplication, user_id, created_at FROM expressions WHERE status = ?
+		ON CONFLICT (id) DO NOTHING`, "pending")
+	if res.RowsAffected > 0 {
+		notifyQueued()
+	}
+	return res.RowsAffected, res.Error
+}
+
+// claimExpiry — срок захвата по часам БД, общим для всех экземпляров
+func claimExpiry(lease time.Duration) clause.Expr {
+	return gorm.Expr("now() + make_interval(secs => ?)", lease.Seconds())
+}
+
+// queued — уведомление простаивающих вычислителей о новых задачах в очереди
+var queued = make(chan struct{}, 1)
+
+// Queued — канал, в который приходит сигнал при постановке задачи в очередь
+// этим процессом. Один сигнал будит одного ожидающего.
+func Queued() <-chan struct{} {
+	return queued
+}
+
+func notifyQueued() {
+	select {
+	case queued <- struct{}{}:
+	default:
+	}
+}
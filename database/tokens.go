@@ -0,0 +1,114 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrRefreshTokenInvalid — токен неизвестен, истёк или отозван вместе с цепочкой
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	// ErrRefreshTokenReused — повторное предъявление уже ротированного токена:
+	// вероятно, токен украден, поэтому отозвана вся цепочка
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// CreateRefreshToken — сохранение нового refresh-токена
+func CreateRefreshToken(token *models.RefreshToken) error {
+	return DB.Create(token).Error
+}
+
+// RotateRefreshToken — обмен refresh-токена с хешем hash на next.
+// Старый токен помечается использованным, next получает его пользователя
+// и цепочку. Предъявленный повторно токен отзывает всю цепочку
+// (ErrRefreshTokenReused; next при этом тоже заполнен — для журнала).
+func RotateRefreshToken(hash string, next *models.RefreshToken) error {
+	var reused bool
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hash).
+			Limit(1).
+			Find(&current)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRefreshTokenInvalid
+		}
+
+		now := time.Now()
+		if current.RevokedAt != nil {
+			// Отзыв цепочки должен сохраниться, поэтому транзакцию не откатываем
+			reused = true
+			next.UserID = current.UserID
+			next.FamilyID = current.FamilyID
+			return revokeFamily(tx, current.FamilyID, now)
+		}
+		if now.After(current.ExpiresAt) {
+			return ErrRefreshTokenInvalid
+		}
+
+		if err := tx.Model(&current).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		next.UserID = current.UserID
+		next.FamilyID = current.FamilyID
+		return tx.Create(next).Error
+	})
+	if err == nil && reused {
+		return ErrRefreshTokenReused
+	}
+	return err
+}
+
+// RevokeRefreshToken — отзыв цепочки, к которой относится токен пользователя
+// (выход из одного сеанса). Неизвестный токен ошибкой не считается.
+func RevokeRefreshToken(hash string, userID uint) error {
+	var token models.RefreshToken
+	res := DB.Where("token_hash = ? AND user_id = ?", hash, userID).Limit(1).Find(&token)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return res.Error
+	}
+	return revokeFamily(DB, token.FamilyID, time.Now())
+}
+
+// RevokeUserRefreshTokens — отзыв всех refresh-токенов пользователя (выход из всех сеансов)
+func RevokeUserRefreshTokens(userID uint) error {
+	return DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func revokeFamily(tx *gorm.DB, familyID string, now time.Time) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error
+}
+
+// RevokeAccessToken — занесение access-токена в denylist до его истечения
+func RevokeAccessToken(jti string, expiresAt time.Time) error {
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+// IsAccessTokenRevoked — находится ли access-токен в denylist
+func IsAccessTokenRevoked(jti string) (bool, error) {
+	var count int64
+	err := DB.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// PurgeExpiredTokens — удаление истёкших refresh-токенов и записей denylist:
+// истёкший токен отвергается и без них
+func PurgeExpiredTokens() error {
+	now := time.Now()
+	if err := DB.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	return DB.Where("expires_at < ?", now).Delete(&models.RefreshToken{}).Error
+}
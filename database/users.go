@@ -0,0 +1,38 @@
+package database
+
+import "github.com/Powdersumm/Yandexlmsfinalproject/models"
+
+// UserExists — есть ли пользователь с таким ID. Удалённые (soft delete)
+// gorm отсеивает сам, поэтому для них — false.
+func UserExists(id uint) (bool, error) {
+	var count int64
+	err := DB.Model(&models.User{}).Where("id = ?", id).Count(&count).Error
+	return count > 0, err
+}
+
+// hashParameters — часть хеша пароля до соли: алгоритм и параметры
+// ($2a$10 у bcrypt, $argon2id$v=19$m=65536,t=1,p=4 у argon2id)
+const hashParameters = `regexp_replace(password_hash, '\$[A-Za-z0-9./+]{20,}.*$', '')`
+
+// CommonPasswordHash — хеш с самыми распространёнными среди пользователей
+// алгоритмом и параметрами; пустая строка, если пользователей нет
+func CommonPasswordHash() (string, error) {
+	var hashes []string
+	err := DB.Model(&models.User{}).
+		Where(hashParameters+` = (?)`, DB.Model(&models.User{}).
+			Select(hashParameters+` AS parameters`).
+			Group("parameters").
+			Order("count(*) DESC").
+			Limit(1)).
+		Limit(1).
+		Pluck("password_hash", &hashes).Error
+	if err != nil || len(hashes) == 0 {
+		return "", err
+	}
+	return hashes[0], nil
+}
+
+// UpdatePasswordHash — замена хеша пароля пользователя
+func UpdatePasswordHash(id uint, hash string) error {
+	return DB.Model(&models.User{}).Where("id = ?", id).Update("password_hash", hash).Error
+}
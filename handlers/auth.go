@@ -2,20 +2,24 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log"
+	"net"
 	"net/http"
 	"os"
-	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/Knetic/govaluate"
+	"github.com/Powdersumm/Yandexlmsfinalproject/auth"
 	"github.com/Powdersumm/Yandexlmsfinalproject/database"
 	"github.com/Powdersumm/Yandexlmsfinalproject/middleware"
 	"github.com/Powdersumm/Yandexlmsfinalproject/models"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/Powdersumm/Yandexlmsfinalproject/pkg/calculation"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
 // Register - обработчик регистрации с улучшенной обработкой ошибок
@@ -32,8 +36,12 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Валидация
-	if len(req.Login) < 3 || len(req.Password) < 6 {
-		http.Error(w, "Login (3+ chars) and password (6+ chars) required", http.StatusBadRequest)
+	if len(req.Login) < 3 {
+		http.Error(w, "Login (3+ chars) required", http.StatusBadRequest)
+		return
+	}
+	if err := auth.Policy.Validate(req.Login, req.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -45,7 +53,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Хеширование пароля
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := auth.Passwords.Hash(req.Password)
 	if err != nil {
 		http.Error(w, "Password processing failed", http.StatusInternalServerError)
 		return
@@ -54,7 +62,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	// Создание пользователя
 	newUser := models.User{
 		Login:        req.Login,
-		PasswordHash: string(hashedPassword),
+		PasswordHash: hashedPassword,
 	}
 	if err := database.DB.Create(&newUser).Error; err != nil {
 		http.Error(w, "User creation failed", http.StatusInternalServerError)
@@ -78,94 +86,147 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Поиск пользователя
+	// Слишком частые неудачи по этой учётной записи или с этого адреса
+	address := clientAddress(r)
+	if wait := auth.Logins.Check(req.Login, address); wait > 0 {
+		auditLogin("throttled", req.Login, address)
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	// Поиск пользователя. Для несуществующего хеш всё равно проверяется
+	// (заглушка), чтобы время ответа не выдавало, есть ли такой логин.
 	var user models.User
-	if database.DB.Where("login = ?", req.Login).First(&user).Error != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	err := database.DB.Where("login = ?", req.Login).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		auth.Logins.Release(req.Login, address)
+		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
+	hash := user.PasswordHash
+	if err != nil {
+		hash = dummyHash()
+	}
 
 	// Проверка пароля
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+	ok, rehash, verifyErr := auth.Passwords.Verify(hash, req.Password)
+	if verifyErr != nil {
+		log.Printf("Ошибка проверки пароля пользователя %d: %v", user.ID, verifyErr)
+	}
+	if !ok || err != nil {
+		wait, locked := auth.Logins.Failure(req.Login, address)
+		auditLogin("failure", req.Login, address)
+		if locked {
+			auditLogin("locked", req.Login, address)
+		}
+		if locked || wait > 0 {
+			w.Header().Set("Retry-After", retryAfter(wait))
+		}
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// Генерация JWT
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := jwt.MapClaims{
-		"sub": user.ID,
-		"exp": expirationTime.Unix(),
-	}
+	auth.Logins.Success(req.Login, address)
+	auditLogin("success", req.Login, address)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	secret := os.Getenv("JWT_SECRET")
-	tokenString, err := token.SignedString([]byte(secret))
-	if err != nil {
-		http.Error(w, "Token generation failed", http.StatusInternalServerError)
-		return
+	// Хеш с прежним алгоритмом или стоимостью заменяется, пока известен пароль
+	if rehash {
+		if hash, err := auth.Passwords.Hash(req.Password); err != nil {
+			log.Printf("Ошибка перехеширования пароля: %v", err)
+		} else if err := database.UpdatePasswordHash(user.ID, hash); err != nil {
+			log.Printf("Ошибка сохранения нового хеша пароля: %v", err)
+		}
 	}
 
-	// Ответ
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"access_token": tokenString,
-		"token_type":   "bearer",
-		"expires_in":   int(time.Until(expirationTime).Seconds()),
-	})
+	// Выдача пары access/refresh
+	issueTokens(w, user.ID)
 }
 
-// AddExpressionHandler - обработчик выражений с сохранением в БД
-var TaskQueue = make(chan models.ExpressionTask, 100)
+// dummyRefreshInterval — как часто заглушка подстраивается под хеши пользователей
+const dummyRefreshInterval = time.Hour
 
-// Добавлено: регулярное выражение для валидации выражений
-var validExpressionRegex = regexp.MustCompile(`^[\d\s+\-*/()]+$`)
-
-func AddExpressionHandler(w http.ResponseWriter, r *http.Request) {
-	type Request struct {
-		Expression string `json:"expression"`
-	}
+// dummy — заглушка для проверки пароля, когда пользователя нет
+var dummy struct {
+	sync.Mutex
+	hash    string
+	updated time.Time
+}
 
-	var req Request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
-		return
+// dummyHash — хеш случайного пароля тем алгоритмом и с теми параметрами, что
+// у большинства пользователей. Не текущими настройками: пока после их смены
+// пользователи не перехешированы, заглушка выдавала бы несуществующий логин
+// по времени проверки. Раз в dummyRefreshInterval пересчитывается.
+func dummyHash() string {
+	dummy.Lock()
+	defer dummy.Unlock()
+	if dummy.hash != "" && time.Since(dummy.updated) < dummyRefreshInterval {
+		return dummy.hash
 	}
 
-	// Валидация
-	if req.Expression == "" || !validExpressionRegex.MatchString(req.Expression) {
-		http.Error(w, "Invalid expression format", http.StatusBadRequest)
-		return
+	sample, err := database.CommonPasswordHash()
+	if err != nil {
+		log.Printf("Ошибка выбора образца хеша пароля: %v", err)
 	}
-
-	// UserID из контекста
-	userID, ok := r.Context().Value(middleware.UserIDKey).(uint)
-	if !ok {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
-		return
+	hash, err := auth.Passwords.HashLike(sample, uuid.New().String())
+	if err != nil {
+		log.Printf("Ошибка генерации заглушки пароля: %v", err)
+		return dummy.hash
 	}
+	dummy.hash, dummy.updated = hash, time.Now()
+	return dummy.hash
+}
 
-	// Сохранение в БД
-	expressionID := uuid.New().String()
-	expr := models.Expression{
-		ID:         expressionID,
-		UserID:     userID,
-		Expression: req.Expression,
-		Status:     "pending",
+// clientAddress — адрес клиента для ограничения попыток входа. За обратным прокси
+// (TRUST_PROXY_HEADERS=true) берётся последний адрес X-Forwarded-For — его добавил
+// сам прокси; предыдущие клиент может подставить любые.
+func clientAddress(r *http.Request) string {
+	if trust, _ := strconv.ParseBool(os.Getenv("TRUST_PROXY_HEADERS")); trust {
+		forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		if last := strings.TrimSpace(forwarded[len(forwarded)-1]); last != "" {
+			return last
+		}
 	}
-	if err := database.DB.Create(&expr).Error; err != nil {
-		http.Error(w, "Failed to save expression", http.StatusInternalServerError)
-		return
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
+	return host
+}
 
-	// Отправка задачи в очередь
-	TaskQueue <- models.ExpressionTask{
-		ID:         expressionID,
-		Expression: req.Expression,
-		UserID:     userID,
+// auditLogin — запись журнала аудита о попытке входа
+func auditLogin(event, login, address string) {
+	log.Printf("audit: login %s login=%q ip=%s", event, login, address)
+}
+
+// tooManyAttempts — ответ 429 с Retry-After
+func tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", retryAfter(wait))
+	http.Error(w, "Too many login attempts", http.StatusTooManyRequests)
+}
+
+// retryAfter — пауза в целых секундах с округлением вверх
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(int((wait + time.Second - 1) / time.Second))
+}
+
+// WriteExpressionError - ответ 400 с причиной ошибки выражения. Для синтаксических
+// ошибок добавляются позиция, ожидаемые токены и фрагмент с ^ под местом ошибки.
+func WriteExpressionError(w http.ResponseWriter, err error) {
+	details := map[string]interface{}{
+		"code":    calculation.Code(err),
+		"message": err.Error(),
+	}
+	var parseErr *calculation.ParseError
+	if errors.As(err, &parseErr) {
+		details["offset"] = parseErr.Offset
+		details["token"] = parseErr.Token
+		details["expected"] = parseErr.Expected
+		details["snippet"] = parseErr.Caret()
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"id": expressionID})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": details})
 }
 
 // GetExpressionsHandler - получение выражений из БД
@@ -201,28 +262,77 @@ func GetExpressionsHandler(w http.ResponseWriter, r *http.Request) {
 	// Формирование ответа
 	response := make([]map[string]interface{}, len(expressions))
 	for i, expr := range expressions {
-		response[i] = map[string]interface{}{
-			"id":         expr.ID,
-			"expression": expr.Expression,
-			"status":     expr.Status,
-			"result":     expr.Result,
-			"created_at": expr.CreatedAt,
-		}
+		response[i] = expressionResponse(expr)
 	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{"expressions": response})
 }
 
-func EvaluateExpression(expr string) (float64, error) {
-	expression, err := govaluate.NewEvaluableExpression(expr)
-	if err != nil {
-		return 0, fmt.Errorf("ошибка парсинга выражения: %v", err)
+// GetExpressionHandler - получение одного выражения по ID.
+// Чужие и несуществующие выражения одинаково отдают 404.
+func GetExpressionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	// Некорректный UUID не может принадлежать ни одному выражению
+	id := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Expression not found", http.StatusNotFound)
+		return
 	}
 
-	result, err := expression.Evaluate(nil)
+	var expr models.Expression
+	err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&expr).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Expression not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		return 0, fmt.Errorf("ошибка вычисления: %v", err)
+		http.Error(w, "Failed to fetch data", http.StatusInternalServerError)
+		return
 	}
 
-	return result.(float64), nil
+	json.NewEncoder(w).Encode(map[string]interface{}{"expression": expressionResponse(expr)})
+}
+
+// expressionResponse - представление выражения в ответах API.
+// result равен null, пока выражение не вычислено, error - null, если ошибки нет.
+func expressionResponse(expr models.Expression) map[string]interface{} {
+	var exprErr interface{}
+	if expr.Status == "error" {
+		exprErr = map[string]string{
+			"code":    expr.ErrorCode,
+			"message": expr.ErrorMessage,
+		}
+	}
+
+	// В десятичном режиме результат отдаётся строкой, чтобы не потерять точность
+	var result interface{}
+	if expr.Status == "completed" {
+		if expr.Mode == models.ModeDecimal && expr.ResultText != nil {
+			result = *expr.ResultText
+		} else if expr.Result != nil {
+			result = *expr.Result
+		}
+	}
+
+	mode := expr.Mode
+	if mode == "" {
+		mode = models.ModeFloat
+	}
+
+	return map[string]interface{}{
+		"id":         expr.ID,
+		"expression": expr.Expression,
+		"variables":  expr.Variables,
+		"mode":       mode,
+		"status":     expr.Status,
+		"result":     result,
+		"error":      exprErr,
+		"created_at": expr.CreatedAt,
+		"updated_at": expr.UpdatedAt,
+	}
 }
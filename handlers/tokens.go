@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/auth"
+	"github.com/Powdersumm/Yandexlmsfinalproject/database"
+	"github.com/Powdersumm/Yandexlmsfinalproject/middleware"
+	"github.com/Powdersumm/Yandexlmsfinalproject/models"
+	"github.com/google/uuid"
+)
+
+// defaultRefreshTokenTTL — срок действия refresh-токена, если не задан REFRESH_TOKEN_TTL
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+// newRefreshToken — случайный refresh-токен и запись о нём для БД (без пользователя и цепочки)
+func newRefreshToken() (string, *models.RefreshToken, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, &models.RefreshToken{
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(auth.DurationFromEnv("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL)),
+	}, nil
+}
+
+// hashToken — SHA-256 токена. Refresh-токен случаен и длинен,
+// поэтому медленный хеш вроде bcrypt ему не нужен.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens — ответ с новой парой токенов для пользователя. Вход начинает
+// новую цепочку refresh-токенов; ротация продолжает существующую.
+func issueTokens(w http.ResponseWriter, userID uint) {
+	refresh, record, err := newRefreshToken()
+	if err != nil {
+		http.Error(w, "Token generation failed", http.StatusInternalServerError)
+		return
+	}
+	record.UserID = userID
+	record.FamilyID = uuid.New().String()
+	if err := database.CreateRefreshToken(record); err != nil {
+		log.Printf("Ошибка сохранения refresh-токена: %v", err)
+		http.Error(w, "Token generation failed", http.StatusInternalServerError)
+		return
+	}
+	writeTokens(w, userID, refresh, record.ExpiresAt)
+}
+
+func writeTokens(w http.ResponseWriter, userID uint, refresh string, refreshExpiresAt time.Time) {
+	access, claims, err := auth.NewAccessToken(userID)
+	if err != nil {
+		http.Error(w, "Token generation failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":       access,
+		"token_type":         "bearer",
+		"expires_in":         int(time.Until(claims.ExpiresAt.Time).Seconds()),
+		"refresh_token":      refresh,
+		"refresh_expires_in": int(time.Until(refreshExpiresAt).Seconds()),
+	})
+}
+
+// Refresh — обмен refresh-токена на новую пару. Предъявленный токен
+// становится недействительным; повторное его предъявление отзывает
+// все токены, выданные по цепочке от того же входа.
+func Refresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	refresh, next, err := newRefreshToken()
+	if err != nil {
+		http.Error(w, "Token generation failed", http.StatusInternalServerError)
+		return
+	}
+
+	err = database.RotateRefreshToken(hashToken(req.RefreshToken), next)
+	switch {
+	case errors.Is(err, database.ErrRefreshTokenReused):
+		log.Printf("Повторное использование refresh-токена пользователя %d, цепочка %s отозвана", next.UserID, next.FamilyID)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	case errors.Is(err, database.ErrRefreshTokenInvalid):
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	case err != nil:
+		log.Printf("Ошибка ротации refresh-токена: %v", err)
+		http.Error(w, "Token refresh failed", http.StatusInternalServerError)
+		return
+	}
+
+	// Refresh-токен удалённого пользователя новых токенов не даёт
+	exists, err := database.UserExists(next.UserID)
+	if err != nil {
+		log.Printf("Ошибка поиска пользователя: %v", err)
+		http.Error(w, "Token refresh failed", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		database.RevokeUserRefreshTokens(next.UserID)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	writeTokens(w, next.UserID, refresh, next.ExpiresAt)
+}
+
+// Logout — отзыв текущего access-токена и refresh-токенов: цепочки
+// переданного refresh_token либо, с "all": true, всех сеансов пользователя
+func Logout(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+		All          bool   `json:"all"`
+	}
+	// Тело необязательно: без него отзывается только access-токен
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint)
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	jti, _ := r.Context().Value(middleware.TokenIDKey).(string)
+	expiresAt, _ := r.Context().Value(middleware.TokenExpiresKey).(time.Time)
+
+	if err := database.RevokeAccessToken(jti, expiresAt); err != nil {
+		log.Printf("Ошибка отзыва access-токена: %v", err)
+		http.Error(w, "Logout failed", http.StatusInternalServerError)
+		return
+	}
+
+	var err error
+	if req.All {
+		err = database.RevokeUserRefreshTokens(userID)
+	} else if req.RefreshToken != "" {
+		err = database.RevokeRefreshToken(hashToken(req.RefreshToken), userID)
+	}
+	if err != nil {
+		log.Printf("Ошибка отзыва refresh-токенов: %v", err)
+		http.Error(w, "Logout failed", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"})
+}
+
+// JWKS — открытые ключи проверки токенов для других сервисов
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(auth.Keys.JWKS())
+}
@@ -2,117 +2,211 @@ package agent
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Powdersumm/Yandexlmsfinalproject/pkg/calculation"
+	"github.com/google/uuid"
 )
 
 type Task struct {
-	ID        string  `json:"id"`
-	Arg1      float64 `json:"arg1"`
-	Arg2      float64 `json:"arg2"`
-	Operation string  `json:"operation"`
+	ID            string  `json:"id"`
+	Arg1          float64 `json:"arg1"`
+	Arg2          float64 `json:"arg2"`
+	Operation     string  `json:"operation"`
+	OperationTime int     `json:"operation_time"` // имитируемая длительность операции, мс
+
+	// Args — аргументы, если Operation — имя функции, а не оператор
+	Args []float64 `json:"args,omitempty"`
 }
 
 type Result struct {
-	ID     string  `json:"id"`
-	Result float64 `json:"result"`
+	ID        string  `json:"id"`
+	Result    float64 `json:"result"`
+	Error     string  `json:"error,omitempty"`
+	ErrorCode string  `json:"error_code,omitempty"` // calculation.Code ошибки
 }
 
-func Start() {
-	for {
-		// Получаем задачу от оркестратора
-		task, found := getTask()
-		if !found {
-			log.Println("No task available, waiting...")
-			time.Sleep(2 * time.Second)
-			continue
-		}
+// IDHeader — заголовок, которым агент представляется оркестратору при получении задачи
+const IDHeader = "X-Agent-ID"
 
-		// Запускаем горутину для обработки каждой задачи
-		go func(task Task) {
-			// Выполняем вычисление задачи
-			result, err := performCalculation(task)
-			if err != nil {
-				log.Println("Error performing calculation:", err)
-				return
-			}
+// TokenHeader — заголовок с общим секретом агентов (AGENT_TOKEN), без которого
+// оркестратор не выдаёт задачи и не принимает результаты
+const TokenHeader = "X-Agent-Token"
 
-			// Отправляем результат обратно в оркестратор
-			err = sendResult(task.ID, result)
-			if err != nil {
-				log.Println("Error sending result:", err)
-			}
+// Config — настройки агента
+type Config struct {
+	OrchestratorURL string        // адрес оркестратора, например http://localhost:8080
+	ComputingPower  int           // число параллельных вычислителей
+	PollInterval    time.Duration // пауза, когда у оркестратора нет задач
+	Evaluator       string        // имя вычислителя операций, см. calculation.LookupEvaluator
+	Token           string        // общий секрет агентов, тот же, что у оркестратора
+}
+
+// ConfigFromEnv — загрузка конфигурации из переменных окружения
+func ConfigFromEnv() *Config {
+	config := &Config{
+		OrchestratorURL: os.Getenv("ORCHESTRATOR_URL"),
+		ComputingPower:  1,
+		PollInterval:    2 * time.Second,
+		Evaluator:       os.Getenv("EVALUATOR"),
+		Token:           os.Getenv("AGENT_TOKEN"),
+	}
+	if config.OrchestratorURL == "" {
+		config.OrchestratorURL = "http://localhost:8080"
+	}
+	if n, err := strconv.Atoi(os.Getenv("COMPUTING_POWER")); err == nil && n > 0 {
+		config.ComputingPower = n
+	}
+	return config
+}
 
-			// Обновляем статус выражения
-			expressions[task.ID].Status = "completed"
-			expressions[task.ID].Result = result
-		}(task)
+// Agent — вычислитель, забирающий операции у оркестратора
+type Agent struct {
+	id        string
+	config    *Config
+	client    *http.Client
+	evaluator calculation.Evaluator
+}
 
-		time.Sleep(2 * time.Second) // Задержка между задачами
+// New — создание агента
+func New(config *Config) *Agent {
+	config.OrchestratorURL = strings.TrimRight(config.OrchestratorURL, "/")
+	evaluator, err := calculation.LookupEvaluator(config.Evaluator)
+	if err != nil {
+		log.Printf("%v, using %s", err, calculation.DefaultEvaluator)
+		evaluator = calculation.Native{}
+	}
+	return &Agent{
+		id:        uuid.New().String(),
+		config:    config,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		evaluator: evaluator,
 	}
 }
 
-func getTask() (Task, error) {
-	var task Task
-	var err error
+// Run — запуск ComputingPower воркеров. Возвращается после отмены ctx,
+// когда все воркеры досчитают и отправят уже взятые задачи.
+func (a *Agent) Run(ctx context.Context) {
+	log.Printf("Agent %s started: orchestrator %s, %d workers", a.id, a.config.OrchestratorURL, a.config.ComputingPower)
+
+	var wg sync.WaitGroup
+	for i := 0; i < a.config.ComputingPower; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			a.worker(ctx, id)
+		}(i)
+	}
+	wg.Wait()
 
-	for attempts := 0; attempts < 3; attempts++ {
-		resp, err := http.Get("http://app:8080/internal/task")
+	log.Println("Agent stopped")
+}
+
+// worker — цикл одного вычислителя: получить задачу, посчитать, отправить результат
+func (a *Agent) worker(ctx context.Context, id int) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Получаем задачу от оркестратора
+		task, found, err := a.getTask(ctx)
 		if err != nil {
-			log.Printf("Error sending GET request to /internal/task: %v", err)
-			time.Sleep(2 * time.Second)
+			log.Printf("Worker %d: error getting task: %v", id, err)
+		}
+		if !found {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(a.config.PollInterval):
+			}
 			continue
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			log.Printf("Failed to get task. HTTP status code: %d", resp.StatusCode)
-			time.Sleep(2 * time.Second)
-			continue
+		// Выполняем вычисление задачи
+		res := Result{ID: task.ID}
+		result, err := Compute(a.evaluator, task)
+		if err != nil {
+			// Ошибку тоже сообщаем оркестратору, иначе выражение зависнет
+			log.Printf("Worker %d: error performing calculation: %v", id, err)
+			res.Error = err.Error()
+			res.ErrorCode = calculation.Code(err)
+		} else {
+			res.Result = result
 		}
 
-		if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
-			log.Printf("Error decoding response body: %v", err)
-			time.Sleep(2 * time.Second)
-			continue
+		// Отправляем результат обратно в оркестратор. Взятую задачу
+		// досылаем и после сигнала остановки, поэтому ctx здесь не используется.
+		if err := a.sendResult(res); err != nil {
+			log.Printf("Worker %d: error sending result: %v", id, err)
 		}
+	}
+}
+
+// getTask — запрос задачи у оркестратора; found == false, если задач нет
+func (a *Agent) getTask(ctx context.Context) (Task, bool, error) {
+	var task Task
 
-		log.Printf("Successfully received task: %v", task)
-		return task, nil
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.config.OrchestratorURL+"/internal/task", nil)
+	if err != nil {
+		return task, false, err
 	}
+	req.Header.Set(IDHeader, a.id)
+	req.Header.Set(TokenHeader, a.config.Token)
 
-	return task, fmt.Errorf("failed to get task after 3 attempts: %v", err)
-}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return task, false, nil
+		}
+		return task, false, fmt.Errorf("GET /internal/task: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return task, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return task, false, fmt.Errorf("failed to get task, HTTP status code: %d", resp.StatusCode)
+	}
 
-func performCalculation(task Task) (float64, error) {
-	// Проверка корректности аргументов (если нужно)
-	if task.Arg1 == 0 || task.Arg2 == 0 {
-		return 0, fmt.Errorf("invalid arguments, task.Arg1 and task.Arg2 must not be zero")
+	if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
+		return task, false, fmt.Errorf("error decoding response body: %v", err)
 	}
 
-	// Формируем строку выражения для вычислений
-	expression := fmt.Sprintf("%f %s %f", task.Arg1, task.Operation, task.Arg2)
+	log.Printf("Successfully received task: %v", task)
+	return task, true, nil
+}
+
+// Compute — вычисление задачи вычислителем evaluator с имитацией её длительности (operation_time)
+func Compute(evaluator calculation.Evaluator, task Task) (float64, error) {
+	if task.OperationTime > 0 {
+		time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
+	}
 
-	// Используем функцию Calc из пакета calculation для вычислений
-	result, err := calculation.Calc(expression)
+	// Задача — ровно одна операция (или вызов функции) над готовыми аргументами
+	args := task.Args
+	if calculation.IsOperator(task.Operation) {
+		args = []float64{task.Arg1, task.Arg2}
+	}
+	result, err := calculation.EvaluateOperation(evaluator, task.Operation, args...)
 	if err != nil {
-		return 0, fmt.Errorf("error calculating expression: %v", err)
+		return 0, fmt.Errorf("error calculating expression: %w", err)
 	}
 
 	return result, nil
 }
 
-func sendResult(taskID string, result float64) error {
-	resultData := Result{
-		ID:     taskID,
-		Result: result,
-	}
-
+func (a *Agent) sendResult(resultData Result) error {
 	data, err := json.Marshal(resultData)
 	if err != nil {
 		log.Printf("Error marshalling result data: %v\n", err)
@@ -120,13 +214,27 @@ func sendResult(taskID string, result float64) error {
 	}
 
 	for attempts := 0; attempts < 3; attempts++ {
-		resp, err := http.Post("http://localhost:8080/internal/task", "application/json", bytes.NewBuffer(data))
+		req, err := http.NewRequest(http.MethodPost, a.config.OrchestratorURL+"/internal/task", bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IDHeader, a.id)
+		req.Header.Set(TokenHeader, a.config.Token)
+
+		resp, err := a.client.Do(req)
 		if err != nil {
 			log.Printf("Error sending result to server: %v\n", err)
 			time.Sleep(2 * time.Second)
 			continue
 		}
-		defer resp.Body.Close()
+		resp.Body.Close()
+
+		// Оркестратор уже не ждёт эту задачу или не принимает наш секрет — повторять бессмысленно
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusConflict ||
+			resp.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf("result for task %s rejected, status code: %d", resultData.ID, resp.StatusCode)
+		}
 
 		if resp.StatusCode != http.StatusOK {
 			log.Printf("Failed to send result, received status code: %d\n", resp.StatusCode)
@@ -134,7 +242,7 @@ func sendResult(taskID string, result float64) error {
 			continue
 		}
 
-		log.Printf("Successfully sent result for task %s, received status: %d\n", taskID, resp.StatusCode)
+		log.Printf("Successfully sent result for task %s, received status: %d\n", resultData.ID, resp.StatusCode)
 		return nil
 	}
 
@@ -1,17 +1,28 @@
 package application
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/Powdersumm/Yandexlmsfinalproject/auth"
 	"github.com/Powdersumm/Yandexlmsfinalproject/database"
 	"github.com/Powdersumm/Yandexlmsfinalproject/handlers"
+	"github.com/Powdersumm/Yandexlmsfinalproject/internal/agent"
+	"github.com/Powdersumm/Yandexlmsfinalproject/internal/orchestrator"
 	"github.com/Powdersumm/Yandexlmsfinalproject/middleware"
 	"github.com/Powdersumm/Yandexlmsfinalproject/models"
+	"github.com/Powdersumm/Yandexlmsfinalproject/pkg/calculation"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -20,7 +31,18 @@ import (
 
 // Config — конфигурация приложения
 type Config struct {
-	Addr string
+	Addr            string
+	OperationTimes  map[string]time.Duration // имитируемая длительность операций
+	LeaseTimeout    time.Duration            // сколько ждать результат операции от агента
+	ClaimTimeout    time.Duration            // срок захвата выражения из очереди БД; продлевается, пока выражение считается
+	MaxAttempts     int                      // сколько раз выдавать операцию, прежде чем признать выражение ошибочным
+	Workers         int                      // число разборщиков выражений из очереди БД
+	Executors       int                      // число встроенных исполнителей операций; 0 — операции считают только агенты
+	ShutdownTimeout time.Duration            // сколько ждать завершения работы при остановке
+	Decimal         calculation.Decimal      // округление в десятичном режиме, если запрос его не задал
+	Evaluator       string                   // вычислитель операций встроенных исполнителей
+	Syntax          calculation.Options      // расширения синтаксиса новых выражений; принятые хранят свои
+	AgentToken      string                   // общий секрет агентов; пустой — внутренние маршруты отключены
 }
 
 // ConfigFromEnv — загрузка конфигурации из переменных окружения
@@ -30,20 +52,93 @@ func ConfigFromEnv() *Config {
 	if config.Addr == "" {
 		config.Addr = "8080"
 	}
+	config.OperationTimes = map[string]time.Duration{
+		"+": durationFromEnv("TIME_ADDITION_MS"),
+		"-": durationFromEnv("TIME_SUBTRACTION_MS"),
+		"*": durationFromEnv("TIME_MULTIPLICATIONS_MS"),
+		"/": durationFromEnv("TIME_DIVISIONS_MS"),
+		"^": durationFromEnv("TIME_EXPONENTIATIONS_MS"),
+	}
+	config.LeaseTimeout = durationFromEnv("TASK_LEASE_TIMEOUT_MS")
+	if config.LeaseTimeout == 0 {
+		config.LeaseTimeout = 30 * time.Second
+	}
+	config.ClaimTimeout = durationFromEnv("QUEUE_CLAIM_TIMEOUT_MS")
+	if config.ClaimTimeout == 0 {
+		config.ClaimTimeout = 30 * time.Second
+	}
+	config.MaxAttempts = 3
+	if n, err := strconv.Atoi(os.Getenv("TASK_MAX_ATTEMPTS")); err == nil && n > 0 {
+		config.MaxAttempts = n
+	}
+	config.Workers = runtime.NumCPU()
+	if n, err := strconv.Atoi(os.Getenv("WORKERS")); err == nil && n > 0 {
+		config.Workers = n
+	}
+	config.Executors = runtime.NumCPU()
+	if n, err := strconv.Atoi(os.Getenv("EXECUTORS")); err == nil && n >= 0 {
+		config.Executors = n
+	}
+	config.ShutdownTimeout = durationFromEnv("SHUTDOWN_TIMEOUT_MS")
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = 15 * time.Second
+	}
+	config.Evaluator = os.Getenv("EVALUATOR")
+	config.AgentToken = os.Getenv("AGENT_TOKEN")
+	config.Syntax.ImplicitMultiplication, _ = strconv.ParseBool(os.Getenv("IMPLICIT_MULTIPLICATION"))
+	config.Decimal = calculation.DefaultDecimal
+	if n, err := strconv.Atoi(os.Getenv("DECIMAL_SCALE")); err == nil && n >= 0 && n <= calculation.MaxScale {
+		config.Decimal.Scale = n
+	}
+	if rounding, err := calculation.ParseRounding(os.Getenv("DECIMAL_ROUNDING")); err == nil {
+		config.Decimal.Rounding = rounding
+	}
 	return config
 }
 
+// durationFromEnv — чтение длительности в миллисекундах; 0, если не задана
+func durationFromEnv(key string) time.Duration {
+	ms, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || ms < 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
 // Application — основная структура приложения
 type Application struct {
-	config *Config
-	db     *gorm.DB
+	config    *Config
+	id        string // имя экземпляра в захватах очереди БД
+	db        *gorm.DB
+	scheduler *orchestrator.Scheduler
+	parser    calculation.Native    // проверка выражений при приёме — тем же разборщиком, что у планировщика
+	evaluator calculation.Evaluator // вычисление операций встроенными исполнителями
+	workers   sync.WaitGroup
 }
 
 // New — создание нового экземпляра приложения
 func New() *Application {
-	return &Application{
+	a := &Application{
 		config: ConfigFromEnv(),
+		id:     generateUniqueID(),
 	}
+	a.scheduler = orchestrator.New(orchestrator.Config{
+		OperationTimes: a.config.OperationTimes,
+		LeaseTimeout:   a.config.LeaseTimeout,
+		MaxAttempts:    a.config.MaxAttempts,
+	}, a.finishExpression)
+
+	a.parser = calculation.Native{Options: a.config.Syntax}
+
+	// Другой вычислитель получает только отдельные операции: выражение целиком
+	// разбирает планировщик, поэтому и принимать его должен тот же разборщик
+	evaluator, err := calculation.LookupEvaluator(a.config.Evaluator)
+	if err != nil {
+		log.Printf("%v, using %s", err, calculation.DefaultEvaluator)
+		evaluator = calculation.Native{}
+	}
+	a.evaluator = evaluator
+	return a
 }
 
 // generateUniqueID — генерация уникального идентификатора
@@ -54,7 +149,11 @@ func generateUniqueID() string {
 // AddExpressionHandler — обработчик POST-запроса для добавления нового выражения
 func (a *Application) AddExpressionHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Expression string `json:"expression"`
+		Expression string             `json:"expression"`
+		Variables  map[string]float64 `json:"variables"`
+		Mode       string             `json:"mode"`     // "float" (по умолчанию) или "decimal"
+		Scale      *int               `json:"scale"`    // только для decimal
+		Rounding   string             `json:"rounding"` // только для decimal
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -67,6 +166,13 @@ func (a *Application) AddExpressionHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Синтаксические ошибки, неизвестные функции и переменные, неверное
+	// число аргументов сообщаем сразу, с позицией ошибки
+	if err := a.parser.ValidateWithVars(req.Expression, req.Variables); err != nil {
+		handlers.WriteExpressionError(w, err)
+		return
+	}
+
 	userID, ok := r.Context().Value(middleware.UserIDKey).(uint)
 	if !ok {
 		http.Error(w, "Authentication required", http.StatusUnauthorized)
@@ -78,10 +184,40 @@ func (a *Application) AddExpressionHandler(w http.ResponseWriter, r *http.Reques
 	newExpression := models.Expression{
 		UserID:     userID,
 		Expression: req.Expression,
+		Variables:  req.Variables,
+		Mode:       models.ModeFloat,
 		Status:     "pending",
+		// Синтаксис фиксируется при создании: выражение, принятое с неявным
+		// умножением, не станет ошибочным после смены IMPLICIT_MULTIPLICATION
+		ImplicitMultiplication: a.config.Syntax.ImplicitMultiplication,
+	}
+
+	switch req.Mode {
+	case "", models.ModeFloat:
+	case models.ModeDecimal:
+		// Параметры округления фиксируются при создании: выражение,
+		// досчитанное после перезапуска, округлится так же
+		decimal := a.config.Decimal
+		if req.Scale != nil {
+			decimal.Scale = *req.Scale
+		}
+		if req.Rounding != "" {
+			decimal.Rounding = calculation.Rounding(req.Rounding)
+		}
+		if err := decimal.Validate(); err != nil {
+			http.Error(w, "Invalid decimal options: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		newExpression.Mode = models.ModeDecimal
+		newExpression.Scale = decimal.Scale
+		newExpression.Rounding = string(decimal.Rounding)
+	default:
+		http.Error(w, "Unknown mode, expected float or decimal", http.StatusBadRequest)
+		return
 	}
 
-	if err := database.DB.Create(&newExpression).Error; err != nil {
+	// Сохранение и постановка в очередь одной транзакцией
+	if err := database.EnqueueExpression(&newExpression); err != nil {
 		log.Printf("Ошибка сохранения выражения: %v", err)
 		http.Error(w, "Failed to save expression", http.StatusInternalServerError)
 		return
@@ -90,48 +226,106 @@ func (a *Application) AddExpressionHandler(w http.ResponseWriter, r *http.Reques
 	// Используйте newExpression.ID после сохранения
 	expressionID := newExpression.ID
 
-	// Отправка задачи в очередь
-	handlers.TaskQueue <- models.ExpressionTask{
-		ID:         expressionID,
-		Expression: req.Expression,
-		UserID:     userID,
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{"id": expressionID})
 }
 
-// processTask — обработка задачи
+// processTask — разбор выражения в граф операций и передача его планировщику
 func (a *Application) processTask(task models.ExpressionTask) {
-	result, err := handlers.EvaluateExpression(task.Expression)
-	status := "completed"
+	// Точная арифметика агентам не передаётся: выражение считается целиком здесь
+	if task.Mode == models.ModeDecimal {
+		a.finishDecimal(task)
+		return
+	}
+	err := a.scheduler.SubmitWithOptions(task.ID, task.Expression, task.Variables, syntax(task))
+	// Захват истёк, и очередь вернула выражение, которое этот экземпляр ещё считает:
+	// вычисление продолжается, захват продлит renewClaims
+	if errors.Is(err, orchestrator.ErrDuplicateSubmit) {
+		log.Printf("Выражение %s уже вычисляется этим экземпляром", task.ID)
+		return
+	}
+	if err != nil {
+		a.finishExpression(task.ID, 0, err)
+	}
+}
+
+// syntax — расширения синтаксиса, с которыми выражение было принято
+func syntax(task models.ExpressionTask) calculation.Options {
+	return calculation.Options{ImplicitMultiplication: task.ImplicitMultiplication}
+}
+
+// localAgentID — имя встроенного в оркестратор исполнителя при выдаче задач
+const localAgentID = "orchestrator"
+
+// executeTask — вычисление одной операции внутри процесса оркестратора
+func (a *Application) executeTask(task agent.Task) {
+	result, err := agent.Compute(a.evaluator, task)
+	if err := a.scheduler.Complete(task.ID, result, err); err != nil {
+		log.Printf("Ошибка приёма результата задачи %s: %v", task.ID, err)
+	}
+}
+
+// finishDecimal — вычисление выражения в десятичном режиме
+func (a *Application) finishDecimal(task models.ExpressionTask) {
+	root, err := calculation.ParseWithOptions(task.Expression, syntax(task))
+	if err != nil {
+		a.saveResult(task.ID, "", err)
+		return
+	}
+	value, err := calculation.EvalDecimal(root, task.Variables)
+	if err != nil {
+		a.saveResult(task.ID, "", err)
+		return
+	}
+	decimal := calculation.Decimal{Scale: task.Scale, Rounding: calculation.Rounding(task.Rounding)}
+	a.saveResult(task.ID, decimal.Format(value), nil)
+}
+
+// finishExpression — сохранение итогового результата выражения в БД
+func (a *Application) finishExpression(id string, result float64, err error) {
+	a.saveResult(id, strconv.FormatFloat(result, 'g', -1, 64), err)
+}
+
+// saveResult — сохранение результата в точной записи text и приближённо числом
+func (a *Application) saveResult(id string, text string, err error) {
+	updates := map[string]interface{}{
+		"status":        "completed",
+		"result":        nil,
+		"result_text":   text,
+		"error_code":    "",
+		"error_message": "",
+	}
+	// Десятичный результат может не поместиться в float64 — тогда только текстом
+	if result, convErr := strconv.ParseFloat(text, 64); convErr == nil {
+		updates["result"] = result
+	}
 	if err != nil {
-		status = "error"
 		log.Printf("Ошибка вычисления: %v", err)
+		updates["status"] = "error"
+		updates["result"] = nil
+		updates["result_text"] = nil
+		updates["error_code"] = errorCode(err)
+		updates["error_message"] = err.Error()
 	}
 
-	// Обновление статуса в БД
-	if err := database.DB.Model(&models.Expression{}).
-		Where("id = ?", task.ID).
-		Updates(map[string]interface{}{
-			"status": status,
-			"result": result,
-		}).Error; err != nil {
+	// Обновление статуса в БД и удаление выражения из очереди
+	updated, err := database.CompleteExpression(id, updates)
+	if err != nil {
 		log.Printf("Ошибка обновления БД: %v", err)
+		return
+	}
+	if !updated {
+		log.Printf("Выражение %s уже завершено другим экземпляром", id)
 	}
 }
 
-// startAgent — запуск агента для обработки задач
-func (a *Application) startAgent() {
-	for {
-		select {
-		case task := <-handlers.TaskQueue:
-			a.processTask(task)
-		default:
-			time.Sleep(1 * time.Second)
-		}
+// errorCode — машиночитаемая причина ошибки выражения
+func errorCode(err error) string {
+	if errors.Is(err, orchestrator.ErrLeaseExhausted) {
+		return "task_timeout"
 	}
+	return calculation.Code(err)
 }
 
 // RunServer — запуск сервера
@@ -140,10 +334,40 @@ func (a *Application) RunServer() error {
 		log.Println("Не найден .env файл")
 	}
 
+	if err := auth.LoadKeys(); err != nil {
+		return fmt.Errorf("Ошибка загрузки ключей JWT: %v", err)
+	}
+	auth.Tokens = auth.TokenConfigFromEnv()
+	auth.Logins = auth.NewLoginThrottle(auth.ThrottleConfigFromEnv())
+
+	hasher, err := auth.PasswordHasherFromEnv()
+	if err != nil {
+		return fmt.Errorf("Ошибка настройки хеширования паролей: %v", err)
+	}
+	policy, err := auth.PasswordPolicyFromEnv(hasher)
+	if err != nil {
+		return fmt.Errorf("Ошибка загрузки политики паролей: %v", err)
+	}
+	auth.Passwords, auth.Policy = hasher, policy
+
+	// Операции, которые некому выдать, не истекают по аренде: выражения висели бы в pending
+	if a.config.Executors == 0 && a.config.AgentToken == "" {
+		return fmt.Errorf("EXECUTORS=0 и не задан AGENT_TOKEN: операции некому считать")
+	}
+
 	if err := database.Connect(); err != nil {
 		return fmt.Errorf("Ошибка подключения к БД: %v", err)
 	}
 
+	// Выражения в статусе pending, которых нет в очереди, возвращаем в неё
+	recovered, err := database.RecoverPending()
+	if err != nil {
+		return fmt.Errorf("Ошибка восстановления очереди: %v", err)
+	}
+	if recovered > 0 {
+		log.Printf("Возвращено в очередь незавершённых выражений: %d", recovered)
+	}
+
 	r := mux.NewRouter()
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -157,17 +381,108 @@ func (a *Application) RunServer() error {
 	// Публичные маршруты
 	r.HandleFunc("/api/v1/register", handlers.Register).Methods("POST")
 	r.HandleFunc("/api/v1/login", handlers.Login).Methods("POST")
+	r.HandleFunc("/api/v1/refresh", handlers.Refresh).Methods("POST")
+	r.HandleFunc("/.well-known/jwks.json", handlers.JWKS).Methods("GET")
 
 	// Защищенные маршруты
 	authRouter := r.PathPrefix("/api/v1").Subrouter()
 	authRouter.Use(middleware.AuthMiddleware)
 	{
+		authRouter.HandleFunc("/logout", handlers.Logout).Methods("POST")
 		authRouter.HandleFunc("/calculate", a.AddExpressionHandler).Methods("POST")
 		authRouter.HandleFunc("/expressions", handlers.GetExpressionsHandler).Methods("GET")
+		authRouter.HandleFunc("/expressions/{id}", handlers.GetExpressionHandler).Methods("GET")
 	}
 
-	go a.startAgent()
+	// Внутренние маршруты для агентов
+	a.mountAgentRoutes(r)
+
+	// Остановка по SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	// По SIGHUP ключи JWT перечитываются: ротация без перезапуска
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+	go reloadKeys(ctx, reload)
+
+	workersCtx, cancelWorkers := context.WithCancel(context.Background())
+	defer cancelWorkers()
+	a.startWorkers(workersCtx)
+
+	srv := &http.Server{
+		Addr:    ":" + a.config.Addr,
+		Handler: r,
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
 	log.Printf("Сервер запущен на порту %s", a.config.Addr)
-	return http.ListenAndServe(":"+a.config.Addr, r)
+
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Получен сигнал остановки, ожидание завершения работы (до %s)", a.config.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.config.ShutdownTimeout)
+	defer cancel()
+
+	// Сначала дожидаемся текущих запросов, затем — разборщиков и встроенных исполнителей
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Ошибка остановки HTTP-сервера: %v", err)
+	}
+	cancelWorkers()
+	a.waitWorkers(shutdownCtx)
+	a.flush()
+
+	log.Println("Сервер остановлен")
+	return nil
+}
+
+// reloadKeys — перечитывание ключей JWT по сигналу; при ошибке остаются прежние ключи
+func reloadKeys(ctx context.Context, reload <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reload:
+			if err := auth.LoadKeys(); err != nil {
+				log.Printf("Ошибка перечитывания ключей JWT: %v", err)
+				continue
+			}
+			log.Println("Ключи JWT перечитаны")
+		}
+	}
+}
+
+// waitWorkers — ожидание завершения разборщиков и исполнителей, но не дольше ctx
+func (a *Application) waitWorkers(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("Вычислители не завершились за отведённое время")
+	}
+}
+
+// flush — освобождение захваченных выражений, чтобы их сразу подхватил
+// другой экземпляр, не дожидаясь истечения захвата
+func (a *Application) flush() {
+	released, err := database.ReleaseClaims(a.id)
+	if err != nil {
+		log.Printf("Ошибка возврата выражений в очередь: %v", err)
+		return
+	}
+	if released > 0 {
+		log.Printf("Возвращено в очередь недосчитанных выражений: %d", released)
+	}
 }
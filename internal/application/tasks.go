@@ -0,0 +1,92 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/internal/agent"
+	"github.com/Powdersumm/Yandexlmsfinalproject/internal/orchestrator"
+	"github.com/Powdersumm/Yandexlmsfinalproject/middleware"
+	"github.com/Powdersumm/Yandexlmsfinalproject/pkg/calculation"
+	"github.com/gorilla/mux"
+)
+
+// mountAgentRoutes — внутренние маршруты агентов под общим секретом AGENT_TOKEN.
+// Без секрета маршруты не подключаются: иначе любой, кто видит API, мог бы
+// забирать чужие операции и подсовывать результаты вычислений чужих выражений.
+func (a *Application) mountAgentRoutes(r *mux.Router) {
+	if a.config.AgentToken == "" {
+		log.Println("AGENT_TOKEN не задан: внешние агенты отключены, операции считают встроенные исполнители")
+		return
+	}
+	internal := r.PathPrefix("/internal").Subrouter()
+	internal.Use(middleware.AgentAuth(a.config.AgentToken))
+	internal.HandleFunc("/task", a.GetTaskHandler).Methods("GET")
+	internal.HandleFunc("/task", a.PostResultHandler).Methods("POST")
+}
+
+// GetTaskHandler — выдача агенту очередной готовой операции (GET /internal/task)
+func (a *Application) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	agentID := r.Header.Get(agent.IDHeader)
+	if agentID == "" {
+		agentID = r.RemoteAddr
+	}
+
+	task, ok := a.scheduler.Next(agentID)
+	if !ok {
+		http.Error(w, "No task available", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+// PostResultHandler — приём результата операции от агента (POST /internal/task)
+func (a *Application) PostResultHandler(w http.ResponseWriter, r *http.Request) {
+	var res agent.Result
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		http.Error(w, "Invalid request", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if res.ID == "" {
+		http.Error(w, "Task ID required", http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Ошибки пакета calculation восстанавливаем по коду, остальные — по тексту
+	var calcErr error
+	if res.ErrorCode != "" || res.Error != "" {
+		calcErr = calculation.FromCode(res.ErrorCode)
+		if calcErr == nil {
+			calcErr = errors.New(res.Error)
+		}
+	}
+
+	if err := a.scheduler.Complete(res.ID, res.Result, calcErr); err != nil {
+		status, message := completeError(err)
+		if status == http.StatusInternalServerError {
+			log.Printf("Ошибка приёма результата задачи %s: %v", res.ID, err)
+		}
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
+}
+
+// completeError — HTTP-статус и сообщение для ошибки приёма результата
+func completeError(err error) (int, string) {
+	switch {
+	case errors.Is(err, orchestrator.ErrUnknownTask):
+		return http.StatusNotFound, "Task not found"
+	case errors.Is(err, orchestrator.ErrTaskNotIssued):
+		return http.StatusConflict, "Task is not outstanding"
+	default:
+		return http.StatusInternalServerError, "Failed to accept result"
+	}
+}
@@ -0,0 +1,158 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/internal/agent"
+	"github.com/Powdersumm/Yandexlmsfinalproject/internal/orchestrator"
+	"github.com/Powdersumm/Yandexlmsfinalproject/models"
+	"github.com/Powdersumm/Yandexlmsfinalproject/pkg/calculation"
+	"github.com/gorilla/mux"
+)
+
+type outcome struct {
+	result float64
+	err    error
+}
+
+// newAgentRouter — внутренние маршруты над планировщиком в памяти, без БД
+func newAgentRouter(token string) (*mux.Router, *orchestrator.Scheduler, map[string]outcome) {
+	done := make(map[string]outcome)
+	a := &Application{config: &Config{AgentToken: token}}
+	a.scheduler = orchestrator.New(orchestrator.Config{
+		LeaseTimeout: time.Minute,
+		MaxAttempts:  3,
+	}, func(id string, result float64, err error) {
+		done[id] = outcome{result, err}
+	})
+	r := mux.NewRouter()
+	a.mountAgentRoutes(r)
+	return r, a.scheduler, done
+}
+
+func agentRequest(r http.Handler, method, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/internal/task", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set(agent.TokenHeader, token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAgentRoutesRequireToken(t *testing.T) {
+	r, _, _ := newAgentRouter("secret")
+	for _, token := range []string{"", "wrong"} {
+		if w := agentRequest(r, "GET", "", token); w.Code != http.StatusUnauthorized {
+			t.Fatalf("token %q: expected 401, got %d", token, w.Code)
+		}
+	}
+
+	// Без AGENT_TOKEN маршруты не подключаются
+	r, _, _ = newAgentRouter("")
+	if w := agentRequest(r, "GET", "", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without configured token, got %d", w.Code)
+	}
+}
+
+func TestGetTaskHandler(t *testing.T) {
+	r, s, _ := newAgentRouter("secret")
+
+	if w := agentRequest(r, "GET", "", "secret"); w.Code != http.StatusNotFound {
+		t.Fatalf("empty queue: expected 404, got %d", w.Code)
+	}
+
+	if err := s.Submit("expr", "6/2", nil); err != nil {
+		t.Fatal(err)
+	}
+	w := agentRequest(r, "GET", "", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var task agent.Task
+	if err := json.NewDecoder(w.Body).Decode(&task); err != nil {
+		t.Fatalf("decode task: %v", err)
+	}
+	if task.ID == "" || task.Operation != "/" || task.Arg1 != 6 || task.Arg2 != 2 {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+}
+
+func TestPostResultHandler(t *testing.T) {
+	r, s, done := newAgentRouter("secret")
+	issue := func(id string) agent.Task {
+		if err := s.Submit(id, "1+2", nil); err != nil {
+			t.Fatal(err)
+		}
+		var task agent.Task
+		json.NewDecoder(agentRequest(r, "GET", "", "secret").Body).Decode(&task)
+		return task
+	}
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{`, http.StatusUnprocessableEntity},
+		{`{"result": 3}`, http.StatusUnprocessableEntity},
+		{`{"id": "unknown", "result": 3}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := agentRequest(r, "POST", tt.body, "secret"); w.Code != tt.status {
+			t.Fatalf("%s: expected %d, got %d", tt.body, tt.status, w.Code)
+		}
+	}
+
+	task := issue("ok")
+	if w := agentRequest(r, "POST", `{"id": "`+task.ID+`", "result": 3}`, "secret"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := done["ok"]; got.err != nil || got.result != 3 {
+		t.Fatalf("expected result 3, got %+v", got)
+	}
+
+	// Ошибка агента восстанавливается по коду, неизвестный код — по тексту
+	task = issue("zero")
+	body := `{"id": "` + task.ID + `", "error": "division by zero", "error_code": "division_by_zero"}`
+	if w := agentRequest(r, "POST", body, "secret"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if err := done["zero"].err; !errors.Is(err, calculation.ErrInvalidZero) {
+		t.Fatalf("expected ErrInvalidZero, got %v", err)
+	}
+
+	task = issue("custom")
+	body = `{"id": "` + task.ID + `", "error": "agent failure", "error_code": "no_such_code"}`
+	agentRequest(r, "POST", body, "secret")
+	if err := done["custom"].err; err == nil || err.Error() != "agent failure" {
+		t.Fatalf("expected agent error text, got %v", err)
+	}
+
+	// Задачу, которую планировщик ещё никому не выдавал, принять нельзя
+	if status, _ := completeError(orchestrator.ErrTaskNotIssued); status != http.StatusConflict {
+		t.Fatalf("expected 409 for a task that was never issued, got %d", status)
+	}
+}
+
+func TestProcessTaskAlreadyScheduled(t *testing.T) {
+	_, s, done := newAgentRouter("secret")
+	a := &Application{config: &Config{}, scheduler: s}
+	task := models.ExpressionTask{ID: "expr", Expression: "1+2"}
+
+	// Очередь вернула выражение повторно (истёк захват): это не ошибка выражения,
+	// и в БД ничего не пишется
+	a.processTask(task)
+	a.processTask(task)
+	if _, ok := done["expr"]; ok {
+		t.Fatal("expression in progress must not be finished")
+	}
+	if pending := s.Pending(); len(pending) != 1 {
+		t.Fatalf("expected the expression to stay scheduled, got %v", pending)
+	}
+}
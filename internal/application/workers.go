@@ -0,0 +1,147 @@
+package application
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/database"
+)
+
+// queuePollInterval — как часто простаивающий разборщик сам проверяет очередь
+// (задачи могут появиться без уведомления: другой экземпляр, восстановление после сбоя)
+const queuePollInterval = time.Second
+
+// startWorkers — запуск разборщиков очереди, встроенных исполнителей операций,
+// фонового возврата просроченных задач, продления захватов очереди и очистки
+// токенов; все они завершаются с отменой ctx
+func (a *Application) startWorkers(ctx context.Context) {
+	log.Printf("Запуск разборщиков очереди: %d", a.config.Workers)
+	for i := 0; i < a.config.Workers; i++ {
+		a.workers.Add(1)
+		go func() {
+			defer a.workers.Done()
+			a.worker(ctx)
+		}()
+	}
+
+	// EXECUTORS=0 — операции считают только агенты
+	if a.config.Executors == 0 {
+		log.Println("Встроенных исполнителей нет: операции считают агенты")
+	} else {
+		log.Printf("Запуск встроенных исполнителей операций: %d", a.config.Executors)
+	}
+	for i := 0; i < a.config.Executors; i++ {
+		a.workers.Add(1)
+		go func() {
+			defer a.workers.Done()
+			a.executor(ctx)
+		}()
+	}
+
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		a.expireLeases(ctx)
+	}()
+
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		a.renewClaims(ctx)
+	}()
+
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		a.purgeTokens(ctx)
+	}()
+}
+
+// worker — разборщик: забирает выражения из очереди БД и передаёт их граф
+// планировщику, а когда очередь пуста — ждёт уведомления, не крутясь вхолостую.
+// Операции он не считает, поэтому медленная операция не задерживает приём выражений.
+func (a *Application) worker(ctx context.Context) {
+	for ctx.Err() == nil {
+		task, err := database.ClaimTask(a.id, a.config.ClaimTimeout)
+		if err != nil {
+			log.Printf("Ошибка чтения очереди: %v", err)
+		}
+		if task != nil {
+			a.processTask(*task)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-database.Queued():
+		case <-time.After(queuePollInterval):
+		}
+	}
+}
+
+// executor — встроенный исполнитель: считает готовые операции планировщика
+// наравне с агентами, а когда их нет — ждёт уведомления
+func (a *Application) executor(ctx context.Context) {
+	for ctx.Err() == nil {
+		if task, ok := a.scheduler.Next(localAgentID); ok {
+			a.executeTask(task)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-a.scheduler.Available():
+		}
+	}
+}
+
+// expireLeases — периодический возврат в очередь задач, результат которых не пришёл вовремя
+func (a *Application) expireLeases(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.scheduler.ExpireLeases()
+		}
+	}
+}
+
+// renewClaims — продление захвата выражений, которые ещё считаются: втрое чаще
+// срока захвата, чтобы одна неудачная попытка не отдала выражение другому экземпляру
+func (a *Application) renewClaims(ctx context.Context) {
+	ticker := time.NewTicker(a.config.ClaimTimeout / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := database.ExtendClaims(a.id, a.scheduler.Pending(), a.config.ClaimTimeout); err != nil {
+				log.Printf("Ошибка продления захвата выражений: %v", err)
+			}
+		}
+	}
+}
+
+// tokenPurgeInterval — как часто удалять истёкшие refresh-токены и записи denylist
+const tokenPurgeInterval = time.Hour
+
+// purgeTokens — периодическая очистка таблиц токенов
+func (a *Application) purgeTokens(ctx context.Context) {
+	ticker := time.NewTicker(tokenPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := database.PurgeExpiredTokens(); err != nil {
+				log.Printf("Ошибка очистки истёкших токенов: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package orchestrator
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/internal/agent"
+	"github.com/Powdersumm/Yandexlmsfinalproject/pkg/calculation"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownTask     = errors.New("unknown task")
+	ErrTaskNotIssued   = errors.New("task is not outstanding")
+	ErrDuplicateSubmit = errors.New("expression already scheduled")
+	ErrLeaseExhausted  = errors.New("task was not completed within the allowed attempts")
+)
+
+// Config — параметры планировщика
+type Config struct {
+	OperationTimes map[string]time.Duration // имитируемая длительность операций ("+", "-", "*", "/", "^")
+	LeaseTimeout   time.Duration            // сколько ждать результат сверх длительности операции
+	MaxAttempts    int                      // сколько раз выдавать задачу, прежде чем признать выражение ошибочным
+}
+
+// DoneFunc — обработчик завершения выражения: итоговое значение либо ошибка
+type DoneFunc func(expressionID string, result float64, err error)
+
+// Scheduler — планировщик: раскладывает выражения на бинарные операции,
+// раздаёт агентам только готовые к вычислению операции и собирает результаты.
+// Состояние хранится в памяти процесса: результат операции принимает только
+// тот экземпляр оркестратора, который её выдал.
+type Scheduler struct {
+	mu          sync.Mutex
+	config      Config
+	expressions map[string]*expression
+	tasks       map[string]*task
+	ready       []*task
+	available   chan struct{}
+	onDone      DoneFunc
+}
+
+// expression — состояние вычисления одного выражения
+type expression struct {
+	id         string
+	graph      *calculation.Graph
+	values     []float64 // результаты уже вычисленных операций
+	waiting    []int     // число ещё не вычисленных операндов каждой операции
+	dependents [][]int   // операции, зависящие от результата данной
+	tasks      map[int]*task
+}
+
+// task — операция графа, ожидающая выдачи или результата от агента
+type task struct {
+	id       string
+	expr     *expression
+	index    int
+	attempts int       // сколько раз задача выдавалась
+	leased   bool      // выдана и ждёт результата
+	holder   string    // агент, которому выдана задача
+	deadline time.Time // до какого момента ждём результат
+}
+
+// New — создание планировщика
+func New(config Config, onDone DoneFunc) *Scheduler {
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	return &Scheduler{
+		config:      config,
+		expressions: make(map[string]*expression),
+		tasks:       make(map[string]*task),
+		available:   make(chan struct{}, 1),
+		onDone:      onDone,
+	}
+}
+
+// Submit — разбор выражения базовым синтаксисом и постановка готовых операций в очередь.
+// Переменные подставляются в граф сразу. Ошибка разбора возвращается
+// сразу, onDone в этом случае не вызывается.
+func (s *Scheduler) Submit(expressionID, source string, vars map[string]float64) error {
+	return s.SubmitWithOptions(expressionID, source, vars, calculation.Options{})
+}
+
+// SubmitWithOptions — Submit с расширениями синтаксиса, с которыми выражение было принято
+func (s *Scheduler) SubmitWithOptions(expressionID, source string, vars map[string]float64, opts calculation.Options) error {
+	root, err := calculation.ParseWithOptions(source, opts)
+	if err != nil {
+		return err
+	}
+	graph, err := calculation.DecomposeNode(root, vars)
+	if err != nil {
+		return err
+	}
+
+	// Выражение из одного числа вычислять не нужно
+	if graph.Root.Const {
+		s.onDone(expressionID, graph.Root.Value, nil)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.expressions[expressionID]; ok {
+		return ErrDuplicateSubmit
+	}
+
+	expr := &expression{
+		id:         expressionID,
+		graph:      graph,
+		values:     make([]float64, len(graph.Operations)),
+		waiting:    make([]int, len(graph.Operations)),
+		dependents: make([][]int, len(graph.Operations)),
+		tasks:      make(map[int]*task),
+	}
+	for i, op := range graph.Operations {
+		for _, arg := range op.Args {
+			if !arg.Const {
+				expr.waiting[i]++
+				expr.dependents[arg.Ref] = append(expr.dependents[arg.Ref], i)
+			}
+		}
+	}
+	s.expressions[expressionID] = expr
+
+	for i := range graph.Operations {
+		if expr.waiting[i] == 0 {
+			s.enqueue(expr, i)
+		}
+	}
+	return nil
+}
+
+// Next — выдача очередной готовой операции агенту agentID под аренду;
+// false, если выдавать нечего
+func (s *Scheduler) Next(agentID string) (agent.Task, bool) {
+	s.ExpireLeases()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.ready) == 0 {
+		return agent.Task{}, false
+	}
+	t := s.ready[0]
+	s.ready = s.ready[1:]
+	if len(s.ready) > 0 {
+		s.signal()
+	}
+
+	op := t.expr.graph.Operations[t.index]
+	opTime := s.config.OperationTimes[op.Operation]
+
+	t.attempts++
+	t.leased = true
+	t.holder = agentID
+	t.deadline = time.Now().Add(opTime + s.config.LeaseTimeout)
+
+	args := make([]float64, len(op.Args))
+	for i, arg := range op.Args {
+		args[i] = t.expr.argument(arg)
+	}
+
+	task := agent.Task{
+		ID:            t.id,
+		Operation:     op.Operation,
+		OperationTime: int(opTime.Milliseconds()),
+	}
+	if calculation.IsOperator(op.Operation) {
+		task.Arg1, task.Arg2 = args[0], args[1]
+	} else {
+		task.Args = args
+	}
+	return task, true
+}
+
+// Complete — приём результата операции. Ошибка вычисления операции
+// завершает всё выражение с этой ошибкой. Результат принимается и от агента,
+// чья аренда уже истекла, пока задача не посчитана кем-то другим.
+func (s *Scheduler) Complete(taskID string, result float64, calcErr error) error {
+	s.mu.Lock()
+	t, ok := s.tasks[taskID]
+	if !ok {
+		s.mu.Unlock()
+		return ErrUnknownTask
+	}
+	if t.attempts == 0 {
+		s.mu.Unlock()
+		return ErrTaskNotIssued
+	}
+
+	expr := t.expr
+	s.forget(t)
+
+	if calcErr != nil {
+		s.drop(expr)
+		s.mu.Unlock()
+		s.onDone(expr.id, 0, calcErr)
+		return nil
+	}
+
+	expr.values[t.index] = result
+	if t.index == expr.graph.Root.Ref {
+		s.drop(expr)
+		s.mu.Unlock()
+		s.onDone(expr.id, result, nil)
+		return nil
+	}
+
+	for _, dep := range expr.dependents[t.index] {
+		expr.waiting[dep]--
+		if expr.waiting[dep] == 0 {
+			s.enqueue(expr, dep)
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Pending — идентификаторы выражений, вычисление которых ещё не завершено
+func (s *Scheduler) Pending() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.expressions))
+	for id := range s.expressions {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// ExpireLeases — возврат в очередь задач с истёкшей арендой. Выражение, задача
+// которого исчерпала MaxAttempts, завершается с ErrLeaseExhausted.
+func (s *Scheduler) ExpireLeases() {
+	s.mu.Lock()
+	now := time.Now()
+	failed := make(map[string]*expression)
+	for _, t := range s.tasks {
+		if !t.leased || now.Before(t.deadline) {
+			continue
+		}
+		log.Printf("Аренда задачи %s агентом %s истекла (попытка %d)", t.id, t.holder, t.attempts)
+		t.leased = false
+		t.holder = ""
+		if t.attempts >= s.config.MaxAttempts {
+			failed[t.expr.id] = t.expr
+			continue
+		}
+		s.ready = append(s.ready, t)
+		s.signal()
+	}
+	for _, expr := range failed {
+		s.drop(expr)
+	}
+	s.mu.Unlock()
+
+	for _, expr := range failed {
+		s.onDone(expr.id, 0, ErrLeaseExhausted)
+	}
+}
+
+// enqueue — постановка операции в очередь выдачи (под блокировкой)
+func (s *Scheduler) enqueue(expr *expression, index int) {
+	t := &task{
+		id:    uuid.New().String(),
+		expr:  expr,
+		index: index,
+	}
+	expr.tasks[index] = t
+	s.tasks[t.id] = t
+	s.ready = append(s.ready, t)
+	s.signal()
+}
+
+// Available — канал, в который приходит сигнал, когда появляется готовая
+// к выдаче операция. Один сигнал будит одного ожидающего.
+func (s *Scheduler) Available() <-chan struct{} {
+	return s.available
+}
+
+// signal — неблокирующее уведомление ожидающих в Available
+func (s *Scheduler) signal() {
+	select {
+	case s.available <- struct{}{}:
+	default:
+	}
+}
+
+// forget — удаление задачи из индекса и очереди (под блокировкой)
+func (s *Scheduler) forget(t *task) {
+	delete(s.tasks, t.id)
+	delete(t.expr.tasks, t.index)
+	for i, r := range s.ready {
+		if r == t {
+			s.ready = append(s.ready[:i], s.ready[i+1:]...)
+			break
+		}
+	}
+}
+
+// drop — снятие выражения со всеми его задачами (под блокировкой)
+func (s *Scheduler) drop(expr *expression) {
+	for _, t := range expr.tasks {
+		s.forget(t)
+	}
+	delete(s.expressions, expr.id)
+}
+
+// argument — значение операнда: число из выражения или результат предыдущей операции
+func (e *expression) argument(arg calculation.Operand) float64 {
+	if arg.Const {
+		return arg.Value
+	}
+	return e.values[arg.Ref]
+}
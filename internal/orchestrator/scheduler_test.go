@@ -0,0 +1,186 @@
+package orchestrator_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/internal/orchestrator"
+	"github.com/Powdersumm/Yandexlmsfinalproject/pkg/calculation"
+)
+
+type outcome struct {
+	result float64
+	err    error
+}
+
+func newScheduler() (*orchestrator.Scheduler, map[string]outcome) {
+	done := make(map[string]outcome)
+	s := orchestrator.New(orchestrator.Config{
+		OperationTimes: map[string]time.Duration{"*": 50 * time.Millisecond},
+		LeaseTimeout:   time.Minute,
+		MaxAttempts:    3,
+	}, func(id string, result float64, err error) {
+		done[id] = outcome{result, err}
+	})
+	return s, done
+}
+
+func TestSchedulerHandsOutOnlyReadyOperations(t *testing.T) {
+	s, done := newScheduler()
+	if err := s.Submit("expr", "(1+2)*(3+4)", nil); err != nil {
+		t.Fatalf("submit returns error: %v", err)
+	}
+	select {
+	case <-s.Available():
+	default:
+		t.Fatal("submit must signal waiting workers")
+	}
+
+	// Обе скобки независимы и выдаются сразу, умножение — только после них
+	first, ok := s.Next("agent")
+	if !ok {
+		t.Fatal("expected first ready task")
+	}
+	second, ok := s.Next("agent")
+	if !ok {
+		t.Fatal("expected second ready task")
+	}
+	if _, ok := s.Next("agent"); ok {
+		t.Fatal("multiplication must wait for its operands")
+	}
+	if first.OperationTime != 0 {
+		t.Fatalf("addition has no configured time, got %d ms", first.OperationTime)
+	}
+
+	for _, task := range []struct {
+		id         string
+		arg1, arg2 float64
+	}{{first.ID, first.Arg1, first.Arg2}, {second.ID, second.Arg1, second.Arg2}} {
+		if err := s.Complete(task.id, task.arg1+task.arg2, nil); err != nil {
+			t.Fatalf("complete returns error: %v", err)
+		}
+	}
+
+	last, ok := s.Next("agent")
+	if !ok {
+		t.Fatal("expected root task after operands are ready")
+	}
+	if last.Operation != "*" || last.Arg1 != 3 || last.Arg2 != 7 || last.OperationTime != 50 {
+		t.Fatalf("unexpected root task %+v", last)
+	}
+	if err := s.Complete(last.ID, 21, nil); err != nil {
+		t.Fatalf("complete returns error: %v", err)
+	}
+
+	if got := done["expr"]; got.err != nil || got.result != 21 {
+		t.Fatalf("expected result 21, got %+v", got)
+	}
+}
+
+func TestSchedulerErrors(t *testing.T) {
+	s, done := newScheduler()
+
+	if err := s.Submit("bad", "1+", nil); err == nil {
+		t.Fatal("invalid expression must not be scheduled")
+	}
+
+	// Синтаксис — свой у каждого выражения, а не общий для планировщика
+	syntax, _ := newScheduler()
+	if err := syntax.Submit("plain", "2(3+4)", nil); err == nil {
+		t.Fatal("implicit multiplication accepted without the option")
+	}
+	implicit := calculation.Options{ImplicitMultiplication: true}
+	if err := syntax.SubmitWithOptions("implicit", "2(3+4)", nil, implicit); err != nil {
+		t.Fatalf("submit with implicit multiplication returns error: %v", err)
+	}
+
+	if err := s.Submit("number", "5", nil); err != nil {
+		t.Fatalf("submit returns error: %v", err)
+	}
+	if got := done["number"]; got.result != 5 {
+		t.Fatalf("single number must complete immediately, got %+v", got)
+	}
+
+	if err := s.Complete("missing", 0, nil); !errors.Is(err, orchestrator.ErrUnknownTask) {
+		t.Fatalf("expected ErrUnknownTask, got %v", err)
+	}
+
+	if err := s.Submit("zero", "1/0+2*3", nil); err != nil {
+		t.Fatalf("submit returns error: %v", err)
+	}
+	task, _ := s.Next("agent")
+	if err := s.Complete(task.ID, 0, calculation.ErrInvalidZero); err != nil {
+		t.Fatalf("complete returns error: %v", err)
+	}
+	if got := done["zero"]; !errors.Is(got.err, calculation.ErrInvalidZero) {
+		t.Fatalf("expected division by zero, got %+v", got)
+	}
+	if _, ok := s.Next("agent"); ok {
+		t.Fatal("tasks of a failed expression must be dropped")
+	}
+	if err := s.Complete(task.ID, 0, nil); !errors.Is(err, orchestrator.ErrUnknownTask) {
+		t.Fatalf("expected ErrUnknownTask for a completed task, got %v", err)
+	}
+}
+
+func TestSchedulerRequeuesExpiredLeases(t *testing.T) {
+	done := make(map[string]outcome)
+	s := orchestrator.New(orchestrator.Config{
+		LeaseTimeout: 10 * time.Millisecond,
+		MaxAttempts:  2,
+	}, func(id string, result float64, err error) {
+		done[id] = outcome{result, err}
+	})
+
+	if err := s.Submit("expr", "2+3", nil); err != nil {
+		t.Fatalf("submit returns error: %v", err)
+	}
+	lost, ok := s.Next("crashed")
+	if !ok {
+		t.Fatal("expected ready task")
+	}
+	if _, ok := s.Next("other"); ok {
+		t.Fatal("leased task must not be handed out twice")
+	}
+
+	// Агент пропал: после истечения аренды задача уходит другому
+	time.Sleep(20 * time.Millisecond)
+	retry, ok := s.Next("other")
+	if !ok || retry.ID != lost.ID {
+		t.Fatalf("expected task %s to be re-issued, got %+v", lost.ID, retry)
+	}
+
+	// Вторая попытка тоже потеряна — лимит исчерпан
+	time.Sleep(20 * time.Millisecond)
+	s.ExpireLeases()
+	if got := done["expr"]; !errors.Is(got.err, orchestrator.ErrLeaseExhausted) {
+		t.Fatalf("expected ErrLeaseExhausted, got %+v", got)
+	}
+	if _, ok := s.Next("other"); ok {
+		t.Fatal("tasks of a failed expression must be dropped")
+	}
+}
+
+func TestSchedulerFunctionCalls(t *testing.T) {
+	s, done := newScheduler()
+	if err := s.Submit("expr", "sqrt(2+2)", nil); err != nil {
+		t.Fatalf("submit returns error: %v", err)
+	}
+
+	sum, _ := s.Next("agent")
+	if err := s.Complete(sum.ID, sum.Arg1+sum.Arg2, nil); err != nil {
+		t.Fatalf("complete returns error: %v", err)
+	}
+
+	root, ok := s.Next("agent")
+	if !ok || root.Operation != "sqrt" || len(root.Args) != 1 || root.Args[0] != 4 {
+		t.Fatalf("expected sqrt task with argument 4, got %+v", root)
+	}
+	if err := s.Complete(root.ID, 2, nil); err != nil {
+		t.Fatalf("complete returns error: %v", err)
+	}
+	if got := done["expr"]; got.err != nil || got.result != 2 {
+		t.Fatalf("expected result 2, got %+v", got)
+	}
+}
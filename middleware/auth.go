@@ -2,29 +2,26 @@ package middleware
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strings"
-	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/Powdersumm/Yandexlmsfinalproject/auth"
+	"github.com/Powdersumm/Yandexlmsfinalproject/database"
 )
 
 type contextKey string
 
 const UserIDKey contextKey = "userID" // 1. Делаем ключ публичным
 
+// Ключи контекста с идентификатором (jti) и сроком действия токена запроса — для выхода
+const (
+	TokenIDKey      contextKey = "tokenID"
+	TokenExpiresKey contextKey = "tokenExpires"
+)
+
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			log.Println("JWT_SECRET not set in environment")
-			http.Error(w, "Server configuration error", http.StatusInternalServerError)
-			return
-		}
-
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			http.Error(w, "Authorization header required", http.StatusUnauthorized)
@@ -37,65 +34,46 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(secret), nil
-		})
-
+		// 3. Подпись (ключ по kid), iss, aud, exp, nbf и iat с допуском на расхождение часов
+		claims, err := auth.ParseAccessToken(tokenString)
 		if err != nil {
-			log.Printf("Token parsing error: %v", err)
+			log.Printf("Token validation error: %v", err)
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
+		userID, _ := claims.UserID()
+		jti := claims.ID
 
-		if !token.Valid {
-			log.Println("Invalid token validation")
-			http.Error(w, "Token is invalid", http.StatusUnauthorized)
-			return
-		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			log.Println("Failed to parse token claims")
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-			return
-		}
-
-		// 3. Проверка expiration с приведением типа
-		exp, ok := claims["exp"].(float64)
-		if !ok {
-			log.Println("Invalid expiration claim type")
-			http.Error(w, "Token expiration claim is invalid", http.StatusUnauthorized)
+		// 4. Проверка отзыва
+		revoked, err := database.IsAccessTokenRevoked(jti)
+		if err != nil {
+			log.Printf("Token denylist check failed: %v", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		}
-
-		if time.Now().Unix() > int64(exp) {
-			log.Println("Token expired")
-			http.Error(w, "Token expired", http.StatusUnauthorized)
+		if revoked {
+			http.Error(w, "Token revoked", http.StatusUnauthorized)
 			return
 		}
 
-		// 4. Проверка subject claim
-		sub, ok := claims["sub"].(float64)
-		if !ok {
-			log.Printf("Invalid sub claim type: %T", claims["sub"])
-			http.Error(w, "Invalid subject claim", http.StatusUnauthorized)
+		// 5. Токен удалённого пользователя больше не действует
+		exists, err := database.UserExists(userID)
+		if err != nil {
+			log.Printf("User lookup failed: %v", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		}
-
-		// 5. Безопасное преобразование float64 -> uint
-		if sub != float64(uint(sub)) || sub < 0 {
-			log.Printf("Invalid user ID value: %f", sub)
-			http.Error(w, "Invalid user ID format", http.StatusUnauthorized)
+		if !exists {
+			log.Printf("Token for deleted user ID: %d", userID)
+			http.Error(w, "User no longer exists", http.StatusUnauthorized)
 			return
 		}
 
-		userID := uint(sub)
 		log.Printf("Authenticated user ID: %d", userID) // 6. Логирование успешной аутентификации
 
 		ctx := context.WithValue(r.Context(), UserIDKey, userID)
+		ctx = context.WithValue(ctx, TokenIDKey, jti)
+		ctx = context.WithValue(ctx, TokenExpiresKey, claims.ExpiresAt.Time)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -4,18 +4,47 @@ import (
 	"time"
 )
 
+// Режимы вычисления выражения
+const (
+	ModeFloat   = "float"   // двоичная плавающая точка, распределённо через агентов
+	ModeDecimal = "decimal" // точная десятичная арифметика, см. calculation.CalcDecimal
+)
+
 type Expression struct {
-	ID         string `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()"`
-	UserID     uint   `gorm:"index"`
-	Expression string
-	Status     string
-	Result     float64
-	CreatedAt  time.Time `gorm:"autoCreateTime"`
-	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+	ID           string `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()"`
+	UserID       uint   `gorm:"index"`
+	Expression   string
+	Variables    map[string]float64 `gorm:"serializer:json"` // значения переменных выражения
+	Mode         string             `gorm:"default:float"`   // ModeFloat или ModeDecimal
+	Scale        int                // знаков после запятой в десятичном режиме
+	Rounding     string             // calculation.Rounding в десятичном режиме
+	Status       string
+	Result       *float64  // nil, пока выражение не вычислено успешно
+	ResultText   *string   // точная запись результата; в десятичном режиме — единственно точная
+	ErrorCode    string    // машиночитаемая причина ошибки (status = "error")
+	ErrorMessage string    // описание ошибки для пользователя
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+
+	// ImplicitMultiplication — calculation.Options, с которыми выражение принято:
+	// досчитанное после перезапуска или смены настроек, оно разбирается так же
+	ImplicitMultiplication bool `gorm:"default:false"`
 }
 
+// ExpressionTask — выражение в очереди на разбор оркестратором. Строка остаётся
+// в очереди, пока выражение не досчитано: захвативший её экземпляр продлевает
+// ClaimedUntil, а после его падения истёкший захват подхватывает другой.
 type ExpressionTask struct {
-	ID         string
-	Expression string
-	UserID     uint
+	ID           string `gorm:"primaryKey;type:uuid"`
+	Expression   string
+	Variables    map[string]float64 `gorm:"serializer:json"`
+	Mode         string             `gorm:"default:float"`
+	Scale        int
+	Rounding     string
+	UserID       uint
+	ClaimedBy    string     // экземпляр оркестратора, который считает выражение
+	ClaimedUntil *time.Time `gorm:"index"` // nil — задача свободна
+	CreatedAt    time.Time  `gorm:"autoCreateTime;index"`
+
+	ImplicitMultiplication bool `gorm:"default:false"`
 }
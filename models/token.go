@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// RefreshToken — выданный refresh-токен. Сам токен не хранится, только его
+// SHA-256: утечка таблицы не даёт войти. Токены одной цепочки ротаций
+// (от одного входа) объединены FamilyID.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"index"`
+	FamilyID  string     `gorm:"type:uuid;index"`
+	TokenHash string     `gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"index"`
+	RevokedAt *time.Time // nil, пока токен не использован для ротации и не отозван
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+}
+
+// RevokedToken — отозванный до срока access-токен (denylist по jti).
+// Запись нужна только до ExpiresAt: после него токен отвергается и так.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index"`
+}
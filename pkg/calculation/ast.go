@@ -0,0 +1,148 @@
+package calculation
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Node — узел дерева выражения: *Number, *Ident, *Unary, *Binary или *FuncCall
+type Node interface {
+	// String — запись выражения с минимально необходимыми скобками
+	String() string
+	node()
+}
+
+// Number — числовой литерал
+type Number struct {
+	Value   float64
+	Literal string // запись числа в выражении; по ней число точно читается в десятичном режиме
+}
+
+// Ident — имя переменной или константы
+type Ident struct {
+	Name string
+	Pos  int // байтовое смещение имени в выражении
+}
+
+// Unary — унарный оператор: "-" или "+"
+type Unary struct {
+	Op      string
+	Operand Node
+}
+
+// Binary — бинарный оператор: "+", "-", "*", "/" или "^"
+type Binary struct {
+	Op    string
+	Left  Node
+	Right Node
+}
+
+// FuncCall — вызов функции
+type FuncCall struct {
+	Name string
+	Args []Node
+	Pos  int // байтовое смещение имени функции в выражении
+}
+
+func (*Number) node()   {}
+func (*Ident) node()    {}
+func (*Unary) node()    {}
+func (*Binary) node()   {}
+func (*FuncCall) node() {}
+
+// atomPrecedence — приоритет узлов, которые никогда не берутся в скобки
+const atomPrecedence = 5
+
+// nodePrecedence — приоритет узла при печати
+func nodePrecedence(n Node) int {
+	switch n := n.(type) {
+	case *Number:
+		// Отрицательное число печатается как унарный минус
+		if n.Value < 0 {
+			return precedence(unaryMinus)
+		}
+	case *Unary:
+		return precedence(unaryMinus)
+	case *Binary:
+		return precedence(rune(n.Op[0]))
+	}
+	return atomPrecedence
+}
+
+// wrap — запись узла, в скобках, если его приоритет ниже требуемого
+func wrap(n Node, min int) string {
+	if nodePrecedence(n) < min {
+		return "(" + n.String() + ")"
+	}
+	return n.String()
+}
+
+func (n *Number) String() string {
+	return strconv.FormatFloat(n.Value, 'g', -1, 64)
+}
+
+func (n *Ident) String() string {
+	return n.Name
+}
+
+func (n *Unary) String() string {
+	return n.Op + wrap(n.Operand, precedence(unaryMinus))
+}
+
+func (n *Binary) String() string {
+	p := precedence(rune(n.Op[0]))
+	// Для левоассоциативных операторов a-(b-c) требует скобок справа,
+	// для правоассоциативного ^ — (a^b)^c слева
+	left, right := p, p+1
+	if rightAssociative(rune(n.Op[0])) {
+		left, right = p+1, p
+	}
+	return wrap(n.Left, left) + n.Op + wrap(n.Right, right)
+}
+
+func (n *FuncCall) String() string {
+	args := make([]string, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = arg.String()
+	}
+	return n.Name + "(" + strings.Join(args, ",") + ")"
+}
+
+// Visitor — обходчик дерева в стиле go/ast: Visit вызывается для каждого узла,
+// возвращённый обходчик используется для его потомков (nil — не спускаться)
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk — обход дерева в глубину, родитель раньше потомков
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case *Unary:
+		Walk(v, n.Operand)
+	case *Binary:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *FuncCall:
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+	}
+}
+
+// inspector — адаптер функции к Visitor
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect — обход дерева функцией f; false из f прекращает спуск в потомков узла
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,265 @@
+package calculation_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/pkg/calculation"
+)
+
+func TestParse(t *testing.T) {
+	node, err := calculation.Parse("-x + max(2, 3) * 4")
+	if err != nil {
+		t.Fatalf("parse returns error: %v", err)
+	}
+
+	sum, ok := node.(*calculation.Binary)
+	if !ok || sum.Op != "+" {
+		t.Fatalf("expected addition at the root, got %#v", node)
+	}
+	if neg, ok := sum.Left.(*calculation.Unary); !ok || neg.Op != "-" {
+		t.Fatalf("expected unary minus on the left, got %#v", sum.Left)
+	}
+	product, ok := sum.Right.(*calculation.Binary)
+	if !ok || product.Op != "*" {
+		t.Fatalf("expected multiplication on the right, got %#v", sum.Right)
+	}
+	if call, ok := product.Left.(*calculation.FuncCall); !ok || call.Name != "max" || len(call.Args) != 2 {
+		t.Fatalf("expected max call with two arguments, got %#v", product.Left)
+	}
+
+	// Parse проверяет только синтаксис
+	if _, err := calculation.Parse("unknown(y)"); err != nil {
+		t.Fatalf("unknown names must be accepted by Parse, got %v", err)
+	}
+	if _, err := calculation.Parse("(1+2"); !errors.Is(err, calculation.ErrInvalidParentheses) {
+		t.Fatalf("expected ErrInvalidParentheses, got %v", err)
+	}
+}
+
+func TestNodeString(t *testing.T) {
+	testCases := []struct {
+		expression string
+		expected   string
+	}{
+		{"1 + 2 * 3", "1+2*3"},
+		{"(1 + 2) * 3", "(1+2)*3"},
+		{"((1))", "1"},
+		{"1 - (2 - 3)", "1-(2-3)"},
+		{"(1 - 2) - 3", "1-2-3"},
+		{"2 ^ 3 ^ 2", "2^3^2"},
+		{"(2 ^ 3) ^ 2", "(2^3)^2"},
+		{"-2 ^ 2", "-2^2"},
+		{"(-2) ^ 2", "(-2)^2"},
+		{"-(1 + 2)", "-(1+2)"},
+		{"max(1, 2 + x) / 0.5", "max(1,2+x)/0.5"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.expression, func(t *testing.T) {
+			node, err := calculation.Parse(testCase.expression)
+			if err != nil {
+				t.Fatalf("parse returns error: %v", err)
+			}
+			if got := node.String(); got != testCase.expected {
+				t.Fatalf("expected %q, got %q", testCase.expected, got)
+			}
+
+			// Напечатанное выражение разбирается в то же дерево
+			again, err := calculation.Parse(node.String())
+			if err != nil || again.String() != node.String() {
+				t.Fatalf("round trip of %q failed: %v", node.String(), err)
+			}
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	node, err := calculation.Parse("a * sin(b) + a")
+	if err != nil {
+		t.Fatalf("parse returns error: %v", err)
+	}
+
+	idents := map[string]int{}
+	calculation.Inspect(node, func(n calculation.Node) bool {
+		if ident, ok := n.(*calculation.Ident); ok {
+			idents[ident.Name]++
+		}
+		return true
+	})
+	if idents["a"] != 2 || idents["b"] != 1 {
+		t.Fatalf("unexpected identifiers %v", idents)
+	}
+
+	// false не даёт спуститься в аргументы функции
+	idents = map[string]int{}
+	calculation.Inspect(node, func(n calculation.Node) bool {
+		if ident, ok := n.(*calculation.Ident); ok {
+			idents[ident.Name]++
+		}
+		_, isCall := n.(*calculation.FuncCall)
+		return !isCall
+	})
+	if idents["b"] != 0 {
+		t.Fatalf("walk must not descend into pruned nodes, got %v", idents)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	program, err := calculation.Compile("x^2 + pow(y, 2)")
+	if err != nil {
+		t.Fatalf("compile returns error: %v", err)
+	}
+	for _, tc := range []struct{ x, y, expected float64 }{{3, 4, 25}, {0, 1, 1}, {-1, -1, 2}} {
+		val, err := program.Eval(map[string]float64{"x": tc.x, "y": tc.y})
+		if err != nil || val != tc.expected {
+			t.Fatalf("x=%f y=%f: expected %f, got %f (%v)", tc.x, tc.y, tc.expected, val, err)
+		}
+	}
+	if _, err := program.Eval(nil); !errors.Is(err, calculation.ErrUnknownVariable) {
+		t.Fatalf("expected ErrUnknownVariable, got %v", err)
+	}
+
+	// Функции проверяются при компиляции, а не при вычислении
+	if _, err := calculation.Compile("nope(1)"); !errors.Is(err, calculation.ErrUnknownFunction) {
+		t.Fatalf("expected ErrUnknownFunction, got %v", err)
+	}
+	if _, err := calculation.Compile("sqrt(1, 2)"); !errors.Is(err, calculation.ErrArity) {
+		t.Fatalf("expected ErrArity, got %v", err)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	testCases := []struct {
+		expression  string
+		offset      int
+		token       string
+		expectedErr error
+		caret       string
+	}{
+		{"1 + * 2", 4, "*", calculation.ErrInvalidExpression, "1 + * 2\n    ^"},
+		{"(1 + 2", 0, "(", calculation.ErrInvalidParentheses, "(1 + 2\n^"},
+		{"1 + 2)", 5, ")", calculation.ErrInvalidParentheses, "1 + 2)\n     ^"},
+		{"2 * ", 4, "", calculation.ErrInvalidValuesCount, "2 * \n    ^"},
+		{"2 $ 3", 2, "$", calculation.ErrInvalidCalculation, "2 $ 3\n  ^"},
+		{"max(1, )", 7, ")", calculation.ErrInvalidExpression, "max(1, )\n       ^"},
+		{"2 ** ** 3", 5, "**", calculation.ErrInvalidExpression, "2 ** ** 3\n     ^"},
+		{"12 34 + 1", 3, "34", calculation.ErrInvalidExpression, "12 34 + 1\n   ^"},
+		{"2 * * 3", 4, "*", calculation.ErrInvalidExpression, "2 * * 3\n    ^"},
+		{"2(3+4)", 1, "(", calculation.ErrInvalidExpression, "2(3+4)\n ^"},
+		{"1 + «2»", 4, "«", calculation.ErrInvalidCalculation, "1 + «2»\n    ^"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.expression, func(t *testing.T) {
+			_, err := calculation.Parse(testCase.expression)
+			var parseErr *calculation.ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected *ParseError, got %v", err)
+			}
+			if !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("expected %v, got %v", testCase.expectedErr, err)
+			}
+			if parseErr.Offset != testCase.offset || parseErr.Token != testCase.token {
+				t.Fatalf("expected offset %d token %q, got %d %q", testCase.offset, testCase.token, parseErr.Offset, parseErr.Token)
+			}
+			if len(parseErr.Expected) == 0 {
+				t.Fatal("expected token set must not be empty")
+			}
+			if caret := parseErr.Caret(); caret != testCase.caret {
+				t.Fatalf("expected caret\n%s\ngot\n%s", testCase.caret, caret)
+			}
+		})
+	}
+
+	// Calc возвращает ту же ошибку
+	if _, err := calculation.Calc("1+"); !errors.As(err, new(*calculation.ParseError)) {
+		t.Fatalf("Calc must return *ParseError, got %v", err)
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	native := calculation.Native{}
+	testCases := []struct {
+		expression  string
+		vars        map[string]float64
+		offset      int
+		token       string
+		expected    string
+		expectedErr error
+	}{
+		{"1 + nope(2)", nil, 4, "nope", "sqrt", calculation.ErrUnknownFunction},
+		{"sqrt(1, 2)", nil, 0, "sqrt", "1 argument", calculation.ErrArity},
+		{"2 * pow(1)", nil, 4, "pow", "2 arguments", calculation.ErrArity},
+		{"max()", nil, 0, "max", "at least 1 argument", calculation.ErrArity},
+		{"x + y * pi", map[string]float64{"x": 1}, 4, "y", "x", calculation.ErrUnknownVariable},
+		{"sqrt(rate) + rate", nil, 5, "rate", "pi", calculation.ErrUnknownVariable},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.expression, func(t *testing.T) {
+			err := native.ValidateWithVars(testCase.expression, testCase.vars)
+			var parseErr *calculation.ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected *ParseError, got %v", err)
+			}
+			if !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("expected %v, got %v", testCase.expectedErr, err)
+			}
+			if parseErr.Offset != testCase.offset || parseErr.Token != testCase.token {
+				t.Fatalf("expected offset %d token %q, got %d %q", testCase.offset, testCase.token, parseErr.Offset, parseErr.Token)
+			}
+			found := false
+			for _, expected := range parseErr.Expected {
+				found = found || expected == testCase.expected
+			}
+			if !found {
+				t.Fatalf("expected %q among %v", testCase.expected, parseErr.Expected)
+			}
+		})
+	}
+
+	if err := native.ValidateWithVars("x * pi + sqrt(x)", map[string]float64{"x": 2}); err != nil {
+		t.Fatalf("known names must pass, got %v", err)
+	}
+	// Без исходной строки позиции нет
+	_, err := calculation.CompileNode(&calculation.FuncCall{Name: "nope"})
+	if !errors.Is(err, calculation.ErrUnknownFunction) || errors.As(err, new(*calculation.ParseError)) {
+		t.Fatalf("expected bare ErrUnknownFunction, got %v", err)
+	}
+}
+
+func TestParseImplicitMultiplication(t *testing.T) {
+	opts := calculation.Options{ImplicitMultiplication: true}
+	testCases := []struct {
+		expression string
+		expected   string
+	}{
+		{"2(3+4)", "2*(3+4)"},
+		{"2pi", "2*pi"},
+		{"2x^2", "2*x^2"},
+		{"(1+2)(3+4)", "(1+2)*(3+4)"},
+		{"1/2pi", "1/2*pi"},
+		{"2sqrt(4)", "2*sqrt(4)"},
+		{"-2(3)", "-2*3"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.expression, func(t *testing.T) {
+			node, err := calculation.ParseWithOptions(testCase.expression, opts)
+			if err != nil {
+				t.Fatalf("parse %q: %v", testCase.expression, err)
+			}
+			if got := node.String(); got != testCase.expected {
+				t.Fatalf("expected %s, got %s", testCase.expected, got)
+			}
+		})
+	}
+
+	// Числа подряд и операнды через пробел — ошибка и с неявным умножением
+	for _, expression := range []string{"12 34", "pi 2", "(2)3", "2 pi", "2 (3+4)", "(1+2) (3+4)"} {
+		if _, err := calculation.ParseWithOptions(expression, opts); !errors.Is(err, calculation.ErrInvalidExpression) {
+			t.Fatalf("%q: expected ErrInvalidExpression, got %v", expression, err)
+		}
+	}
+}
@@ -1,26 +1,246 @@
 package calculation
 
 import (
+	"errors"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 func Calc(expression string) (float64, error) {
-	expression = strings.ReplaceAll(expression, " ", "")
-	result, err := evaluateexpression(expression)
+	return CalcWithVars(expression, nil)
+}
+
+// CalcWithVars — вычисление выражения с переменными. Переменные перекрывают
+// одноимённые встроенные константы (pi, e).
+func CalcWithVars(expression string, vars map[string]float64) (float64, error) {
+	program, err := Compile(expression)
+	if err != nil {
+		return 0, err
+	}
+	result, err := program.Eval(vars)
 	if err != nil {
 		return 0, err
 	}
 	return result, nil
 }
 
-func searchnumbers(expression string, index int) (float64, int) {
+// Options — необязательные расширения синтаксиса
+type Options struct {
+	// ImplicitMultiplication — умножение без знака: 2(3+4), 2pi, (1+2)(3+4).
+	// Знак подразумевается между числом или ) и следующими за ними именем
+	// или (; два числа подряд (12 34) остаются ошибкой.
+	ImplicitMultiplication bool
+}
+
+// Parse — разбор выражения в дерево (AST). Проверяется только синтаксис:
+// существование функций и переменных проверяют Compile и Eval.
+// Ошибки разбора возвращаются как *ParseError с позицией в исходной строке.
+func Parse(expression string) (Node, error) {
+	return ParseWithOptions(expression, Options{})
+}
+
+// ParseWithOptions — разбор выражения с расширениями синтаксиса
+func ParseWithOptions(expression string, opts Options) (Node, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{source: expression, opts: opts}
+	return p.parseexpression(tokens)
+}
+
+// constants — встроенные именованные константы
+var constants = map[string]float64{
+	"pi":  math.Pi,
+	"e":   math.E,
+	"tau": 2 * math.Pi,
+	"phi": math.Phi,
+}
+
+// lookupIdentifier — значение переменной или константы
+func lookupIdentifier(name string, vars map[string]float64) (float64, bool) {
+	if val, ok := vars[name]; ok {
+		return val, true
+	}
+	val, ok := constants[name]
+	return val, ok
+}
+
+// identifierNames — имена переменных и констант по алфавиту
+func identifierNames(vars map[string]float64) []string {
+	names := make([]string, 0, len(vars)+len(constants))
+	for name := range vars {
+		names = append(names, name)
+	}
+	for name := range constants {
+		if _, ok := vars[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply — выполнение одной бинарной операции над готовыми аргументами
+func Apply(op string, a, b float64) (float64, error) {
+	var result float64
+	switch op {
+	case "+":
+		result = a + b
+	case "-":
+		result = a - b
+	case "*":
+		result = a * b
+	case "/":
+		if b == 0 {
+			return 0, ErrInvalidZero
+		}
+		result = a / b
+	case "^":
+		result = math.Pow(a, b)
+	default:
+		return 0, ErrInvalidOperand
+	}
+	return checkResult(result)
+}
+
+// checkResult — отсев результатов, не являющихся конечным вещественным числом
+func checkResult(result float64) (float64, error) {
+	if math.IsInf(result, 0) {
+		return 0, ErrOverflow
+	}
+	if math.IsNaN(result) {
+		return 0, ErrNotANumber
+	}
+	return result, nil
+}
+
+// Унарные операторы хранятся в стеке операторов под отдельными символами,
+// чтобы не путать их с бинарными + и -
+const (
+	unaryMinus rune = '~'
+	unaryPlus  rune = '#'
+)
+
+// IsOperator — является ли op бинарным оператором (а не именем функции)
+func IsOperator(op string) bool {
+	return len(op) == 1 && isOperator(op[0])
+}
+
+// searchnumbers — разбор числового литерала с позиции index: десятичные
+// (1, 1.5, .5, 5., 1e-3, 1_000) и целые 0x1F, 0o17, 0b101. Возвращает позицию
+// за литералом; при ошибке — за всем «прилипшим» к нему хвостом.
+func searchnumbers(expression string, index int) (float64, int, error) {
 	start := index
-	for index < len(expression) && (isDigit(expression[index]) || expression[index] == '.') {
+
+	if index+1 < len(expression) && expression[index] == '0' {
+		if base := literalBase(expression[index+1]); base != 0 {
+			index += 2
+			for index < len(expression) && (isBaseDigit(expression[index], base) || expression[index] == '_') {
+				index++
+			}
+			if index < len(expression) && (isDigit(expression[index]) || isLetter(expression[index]) || expression[index] == '.') {
+				return 0, skipliteral(expression, index), ErrInvalidNumber
+			}
+			val, err := strconv.ParseUint(expression[start:index], 0, 64)
+			if err != nil {
+				return 0, index, ErrInvalidNumber
+			}
+			return float64(val), index, nil
+		}
+	}
+
+	index = skipdigits(expression, index)
+	if index < len(expression) && expression[index] == '.' {
+		index = skipdigits(expression, index+1)
+	}
+	// Экспонента — только если за e идут цифры: 2e без цифр — это 2 и константа e
+	if index < len(expression) && (expression[index] == 'e' || expression[index] == 'E') {
+		next := index + 1
+		if next < len(expression) && (expression[next] == '+' || expression[next] == '-') {
+			next++
+		}
+		if next < len(expression) && isDigit(expression[next]) {
+			index = skipdigits(expression, next)
+		}
+	}
+	// 1.2.3, 1e5.5 — вторая точка не может продолжать литерал
+	if index < len(expression) && expression[index] == '.' {
+		return 0, skipliteral(expression, index), ErrInvalidNumber
+	}
+
+	literal := expression[start:index]
+	if !validUnderscores(literal) {
+		return 0, index, ErrInvalidNumber
+	}
+	val, err := strconv.ParseFloat(strings.ReplaceAll(literal, "_", ""), 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, index, ErrOverflow
+	}
+	if err != nil {
+		return 0, index, ErrInvalidNumber
+	}
+	return val, index, nil
+}
+
+// isNumberStart — начинается ли с позиции index числовой литерал
+func isNumberStart(expression string, index int) bool {
+	if isDigit(expression[index]) {
+		return true
+	}
+	return expression[index] == '.' && index+1 < len(expression) && isDigit(expression[index+1])
+}
+
+func literalBase(prefix byte) int {
+	switch prefix {
+	case 'x', 'X':
+		return 16
+	case 'o', 'O':
+		return 8
+	case 'b', 'B':
+		return 2
+	}
+	return 0
+}
+
+func isBaseDigit(char byte, base int) bool {
+	switch base {
+	case 16:
+		return isDigit(char) || char >= 'a' && char <= 'f' || char >= 'A' && char <= 'F'
+	case 8:
+		return char >= '0' && char <= '7'
+	}
+	return char == '0' || char == '1'
+}
+
+func skipdigits(expression string, index int) int {
+	for index < len(expression) && (isDigit(expression[index]) || expression[index] == '_') {
+		index++
+	}
+	return index
+}
+
+// skipliteral — конец ошибочного литерала, чтобы показать его целиком
+func skipliteral(expression string, index int) int {
+	for index < len(expression) && (isDigit(expression[index]) || isLetter(expression[index]) || expression[index] == '.') {
 		index++
 	}
-	val, _ := strconv.ParseFloat(expression[start:index], 64)
-	return val, index
+	return index
+}
+
+// validUnderscores — _ допустим только между цифрами: 1_000, но не _1, 1_ или 1__0
+func validUnderscores(literal string) bool {
+	for i := 0; i < len(literal); i++ {
+		if literal[i] != '_' {
+			continue
+		}
+		if i == 0 || i == len(literal)-1 || !isDigit(literal[i-1]) || !isDigit(literal[i+1]) {
+			return false
+		}
+	}
+	return true
 }
 
 func precedence(op rune) int {
@@ -29,93 +249,256 @@ func precedence(op rune) int {
 		return 1
 	case '*', '/':
 		return 2
+	case unaryMinus, unaryPlus:
+		return 3
+	case '^':
+		return 4
 	}
 	return 0
 }
 
+// rightAssociative — 2^3^2 = 2^(3^2)
+func rightAssociative(op rune) bool {
+	return op == '^'
+}
+
+func isUnary(op rune) bool {
+	return op == unaryMinus || op == unaryPlus
+}
+
 func isDigit(char byte) bool {
 	return char >= '0' && char <= '9'
 }
 
+func isLetter(char byte) bool {
+	return char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char == '_'
+}
+
+func isIdentifier(name string) bool {
+	if name == "" || !isLetter(name[0]) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isLetter(name[i]) && !isDigit(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func searchidentifier(expression string, index int) (string, int) {
+	start := index
+	for index < len(expression) && (isLetter(expression[index]) || isDigit(expression[index])) {
+		index++
+	}
+	return expression[start:index], index
+}
+
 func isOperator(char byte) bool {
-	return char == '+' || char == '-' || char == '*' || char == '/'
+	return char == '+' || char == '-' || char == '*' || char == '/' || char == '^'
+}
+
+// Ожидаемые токены для ParseError
+var (
+	expectedOperand  = []string{"number", "identifier", "(", "-", "+"}
+	expectedOperator = []string{"operator", ")", ",", "end of expression"}
+)
+
+// parser — состояние разбора, нужное для построения ParseError
+type parser struct {
+	source string
+	opts   Options
+}
+
+// fail — ошибка разбора на токене tok
+func (p *parser) fail(err error, tok token, expected []string) *ParseError {
+	return &ParseError{
+		Expression: p.source,
+		Offset:     tok.pos,
+		Token:      tok.text,
+		Expected:   expected,
+		Err:        err,
+	}
 }
 
-func evaluateexpression(expression string) (float64, error) {
+func (p *parser) parseexpression(tokens []token) (Node, error) {
 	var ops []rune
-	var values []float64
-	for i := 0; i < len(expression); i++ {
-		char := expression[i]
-		if isDigit(char) {
-			val, nextindex := searchnumbers(expression, i)
-			values = append(values, val)
-			i = nextindex - 1
-		} else if char == '(' {
+	var values []Node
+	// parens — открытые скобки по порядку, включая скобки вызовов функций
+	var parens []*paren
+	// expectOperand — ждём число или открывающую скобку: в этом месте
+	// + и - могут быть только унарными
+	expectOperand := true
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+
+		// 2pi, 2(3+4), (1+2)(3+4) — подставляем пропущенный знак умножения.
+		// Только вплотную: пробел разделяет токены, и "2 pi" — два операнда подряд.
+		if !expectOperand && p.opts.ImplicitMultiplication &&
+			(tok.kind == tokenIdent || tok.kind == tokenLParen) &&
+			(tokens[i-1].kind == tokenNumber || tokens[i-1].kind == tokenRParen) &&
+			tokens[i-1].pos+len(tokens[i-1].text) == tok.pos {
+			ops, values = pushOperator('*', ops, values)
+			expectOperand = true
+		}
+
+		switch tok.kind {
+		case tokenNumber:
+			if !expectOperand {
+				return nil, p.fail(ErrInvalidExpression, tok, expectedOperator)
+			}
+			values = append(values, &Number{Value: tok.value, Literal: tok.text})
+			expectOperand = false
+
+		case tokenIdent:
+			if !expectOperand {
+				return nil, p.fail(ErrInvalidExpression, tok, expectedOperator)
+			}
+			// Имя без скобки — переменная или константа
+			if tokens[i+1].kind != tokenLParen {
+				values = append(values, &Ident{Name: tok.text, Pos: tok.pos})
+				expectOperand = false
+				continue
+			}
 			ops = append(ops, '(')
-		} else if char == ')' {
-			for len(ops) > 0 && ops[len(ops)-1] != '(' {
-				var err error
-				values, err = attachOperator(ops[len(ops)-1], values)
-				if err != nil {
-					return 0, ErrInvalidExpression
-				}
-				ops = ops[:len(ops)-1]
+			parens = append(parens, &paren{pos: i, call: true, name: tok.text})
+			i++
+			expectOperand = true
+
+		case tokenLParen:
+			if !expectOperand {
+				return nil, p.fail(ErrInvalidExpression, tok, expectedOperator)
 			}
-			if len(ops) == 0 {
-				return 0, ErrInvalidParentheses
+			ops = append(ops, '(')
+			parens = append(parens, &paren{pos: i})
+			expectOperand = true
+
+		case tokenComma:
+			if expectOperand {
+				return nil, p.fail(ErrInvalidExpression, tok, expectedOperand)
+			}
+			if len(parens) == 0 || !parens[len(parens)-1].call {
+				return nil, p.fail(ErrInvalidExpression, tok, expectedOperator)
+			}
+			ops, values = reduceParentheses(ops, values)
+			parens[len(parens)-1].args++
+			expectOperand = true
+
+		case tokenRParen:
+			if len(parens) == 0 {
+				return nil, p.fail(ErrInvalidParentheses, tok, expectedOperator)
 			}
+			frame := parens[len(parens)-1]
+			// f() — вызов без аргументов; в остальных случаях перед ) нужен операнд
+			emptyCall := frame.call && frame.args == 0 && tokens[i-1].kind == tokenLParen
+			if expectOperand && !emptyCall {
+				return nil, p.fail(ErrInvalidExpression, tok, expectedOperand)
+			}
+			ops, values = reduceParentheses(ops, values)
 			ops = ops[:len(ops)-1]
-		} else if isOperator(char) {
-			for len(ops) > 0 && precedence(rune(char)) <= precedence(ops[len(ops)-1]) {
-				var err error
-				values, err = attachOperator(ops[len(ops)-1], values)
-				if err != nil {
-					return 0, err
+			parens = parens[:len(parens)-1]
+			if frame.call {
+				argc := frame.args + 1
+				if emptyCall {
+					argc = 0
+				}
+				values = attachCall(frame, argc, tokens[frame.pos].pos, values)
+			}
+			expectOperand = false
+
+		case tokenOperator:
+			op := rune(tok.text[0])
+			if tok.text == "**" {
+				op = '^'
+			}
+			if expectOperand {
+				// Префиксный оператор ничего не выталкивает из стека
+				switch op {
+				case '-':
+					ops = append(ops, unaryMinus)
+					continue
+				case '+':
+					ops = append(ops, unaryPlus)
+					continue
 				}
-				ops = ops[:len(ops)-1]
+				return nil, p.fail(ErrInvalidExpression, tok, expectedOperand)
+			}
+			ops, values = pushOperator(op, ops, values)
+			expectOperand = true
+
+		case tokenEnd:
+			if expectOperand {
+				return nil, p.fail(ErrInvalidValuesCount, tok, expectedOperand)
+			}
+
+		default:
+			expected := expectedOperator
+			if expectOperand {
+				expected = expectedOperand
 			}
-			ops = append(ops, rune(char))
-		} else {
-			return 0, ErrInvalidCalculation
+			return nil, p.fail(ErrInvalidCalculation, tok, expected)
 		}
 	}
+	if len(parens) > 0 {
+		return nil, p.fail(ErrInvalidParentheses, tokens[parens[len(parens)-1].pos], []string{")"})
+	}
 	for len(ops) > 0 {
-		var err error
-		values, err = attachOperator(ops[len(ops)-1], values)
-		if err != nil {
-			return 0, err
-		}
+		values = attachOperator(ops[len(ops)-1], values)
 		ops = ops[:len(ops)-1]
 	}
-	if len(values) != 1 {
-		return 0, ErrInvalidValuesCount
-	}
 	return values[0], nil
 }
 
-func attachOperator(op rune, values []float64) ([]float64, error) {
-	if len(values) < 2 {
-		return values, ErrInvalidValuesCount
+// pushOperator — бинарный оператор в стек, после применения предыдущих
+// операторов с большим приоритетом (или равным, если op левоассоциативен)
+func pushOperator(op rune, ops []rune, values []Node) ([]rune, []Node) {
+	for len(ops) > 0 && (precedence(op) < precedence(ops[len(ops)-1]) ||
+		precedence(op) == precedence(ops[len(ops)-1]) && !rightAssociative(op)) {
+		values = attachOperator(ops[len(ops)-1], values)
+		ops = ops[:len(ops)-1]
+	}
+	return append(ops, op), values
+}
+
+// paren — открытая скобка, обычная или вызова функции
+type paren struct {
+	pos  int    // индекс токена открывающей скобки (для вызова — имени функции)
+	call bool   // скобка вызова функции name
+	name string // имя функции
+	args int    // число аргументов, завершённых запятой
+}
+
+// reduceParentheses — применение операторов до ближайшей открывающей скобки
+func reduceParentheses(ops []rune, values []Node) ([]rune, []Node) {
+	for len(ops) > 0 && ops[len(ops)-1] != '(' {
+		values = attachOperator(ops[len(ops)-1], values)
+		ops = ops[:len(ops)-1]
 	}
-	a := values[len(values)-1]
-	b := values[len(values)-2]
-	values = values[:len(values)-2]
-	var result float64
-	switch op {
-	case '+':
-		result = b + a
-	case '-':
-		result = b - a
-	case '*':
-		result = b * a
-	case '/':
-		if a == 0 {
-			return values, ErrInvalidZero
+	return ops, values
+}
+
+// attachCall — замена argc последних значений узлом вызова функции;
+// pos — смещение имени функции в выражении
+func attachCall(frame *paren, argc, pos int, values []Node) []Node {
+	args := append([]Node(nil), values[len(values)-argc:]...)
+	values = values[:len(values)-argc]
+	return append(values, &FuncCall{Name: frame.name, Args: args, Pos: pos})
+}
+
+// attachOperator — замена операндов узлом оператора. Чередование операндов
+// и операторов проверяется при разборе, поэтому операндов всегда хватает.
+func attachOperator(op rune, values []Node) []Node {
+	if isUnary(op) {
+		unary := &Unary{Op: "+", Operand: values[len(values)-1]}
+		if op == unaryMinus {
+			unary.Op = "-"
 		}
-		result = b / a
-	default:
-		return values, ErrInvalidOperand
+		values[len(values)-1] = unary
+		return values
 	}
-	values = append(values, result)
-	return values, nil
+
+	a := values[len(values)-1]
+	c := values[len(values)-2]
+	values = values[:len(values)-2]
+	return append(values, &Binary{Op: string(op), Left: c, Right: a})
 }
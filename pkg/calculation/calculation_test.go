@@ -1,6 +1,8 @@
 package calculation_test
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/Powdersumm/Yandexlmsfinalproject/pkg/calculation"
@@ -57,7 +59,7 @@ func TestCalc(t *testing.T) {
 		},
 		{
 			name:       "priority",
-			expression: "5+6**1",
+			expression: "5+6*/1",
 		},
 		{
 			name:       "priority",
@@ -78,3 +80,414 @@ func TestCalc(t *testing.T) {
 		})
 	}
 }
+
+func TestDecompose(t *testing.T) {
+	testCases := []struct {
+		name           string
+		expression     string
+		operations     int
+		expectedResult float64
+	}{
+		{
+			name:           "number",
+			expression:     "42",
+			operations:     0,
+			expectedResult: 42,
+		},
+		{
+			name:           "simple",
+			expression:     "1+1",
+			operations:     1,
+			expectedResult: 2,
+		},
+		{
+			name:           "independent",
+			expression:     "(1+2)*(3+4)",
+			operations:     3,
+			expectedResult: 21,
+		},
+		{
+			name:           "priority",
+			expression:     "2+2*2-6/3",
+			operations:     4,
+			expectedResult: 4,
+		},
+		{
+			name:           "negative number",
+			expression:     "-2*-3",
+			operations:     1,
+			expectedResult: 6,
+		},
+		{
+			name:           "negated operation",
+			expression:     "-(1+2)",
+			operations:     2,
+			expectedResult: -3,
+		},
+		{
+			name:           "function",
+			expression:     "max(1+2,sqrt(16),2)*2",
+			operations:     4,
+			expectedResult: 8,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			graph, err := calculation.Decompose(testCase.expression)
+			if err != nil {
+				t.Fatalf("successful case %s returns error: %v", testCase.expression, err)
+			}
+			if len(graph.Operations) != testCase.operations {
+				t.Fatalf("expected %d operations, got %d", testCase.operations, len(graph.Operations))
+			}
+
+			// Сворачиваем граф последовательно: операции упорядочены по зависимостям
+			values := make([]float64, len(graph.Operations))
+			arg := func(o calculation.Operand) float64 {
+				if o.Const {
+					return o.Value
+				}
+				return values[o.Ref]
+			}
+			for i, op := range graph.Operations {
+				args := make([]float64, len(op.Args))
+				for j, a := range op.Args {
+					if !a.Const && a.Ref >= i {
+						t.Fatalf("operation %d references a later operation", i)
+					}
+					args[j] = arg(a)
+				}
+				if calculation.IsOperator(op.Operation) {
+					values[i], err = calculation.Apply(op.Operation, args[0], args[1])
+				} else {
+					values[i], err = calculation.Call(op.Operation, args...)
+				}
+				if err != nil {
+					t.Fatalf("operation %d returns error: %v", i, err)
+				}
+			}
+			if val := arg(graph.Root); val != testCase.expectedResult {
+				t.Fatalf("%f should be equal %f", val, testCase.expectedResult)
+			}
+		})
+	}
+
+	for _, expression := range []string{"9-9*", "(((1-3+*(5", "", "2+a"} {
+		if _, err := calculation.Decompose(expression); err == nil {
+			t.Fatalf("expression %s is invalid but was decomposed", expression)
+		}
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	_, err := calculation.Calc("2/0")
+	if code := calculation.Code(err); code != "division_by_zero" {
+		t.Fatalf("expected division_by_zero, got %q", code)
+	}
+	if !errors.Is(calculation.FromCode("division_by_zero"), calculation.ErrInvalidZero) {
+		t.Fatal("code must map back to ErrInvalidZero")
+	}
+	if code := calculation.Code(fmt.Errorf("wrapped: %w", calculation.ErrInvalidParentheses)); code != "invalid_parentheses" {
+		t.Fatalf("expected invalid_parentheses for wrapped error, got %q", code)
+	}
+	if code := calculation.Code(errors.New("boom")); code != calculation.CodeInternal {
+		t.Fatalf("expected %q, got %q", calculation.CodeInternal, code)
+	}
+	if calculation.Code(nil) != "" || calculation.FromCode("unknown") != nil {
+		t.Fatal("nil error and unknown code must map to zero values")
+	}
+}
+
+func TestCalcUnary(t *testing.T) {
+	testCasesSuccess := []struct {
+		name           string
+		expression     string
+		expectedResult float64
+	}{
+		{name: "leading minus", expression: "-5+3", expectedResult: -2},
+		{name: "leading plus", expression: "+5-3", expectedResult: 2},
+		{name: "after operator", expression: "2*-3", expectedResult: -6},
+		{name: "after division", expression: "6/-2", expectedResult: -3},
+		{name: "before parentheses", expression: "-(1+2)", expectedResult: -3},
+		{name: "inside parentheses", expression: "(-1+2)*3", expectedResult: 3},
+		{name: "binds tighter than multiplication", expression: "-2*3+1", expectedResult: -5},
+		{name: "double minus", expression: "--4", expectedResult: 4},
+		{name: "minus after minus", expression: "1--1", expectedResult: 2},
+		{name: "with spaces", expression: "3 - -2", expectedResult: 5},
+	}
+
+	for _, testCase := range testCasesSuccess {
+		t.Run(testCase.name, func(t *testing.T) {
+			val, err := calculation.Calc(testCase.expression)
+			if err != nil {
+				t.Fatalf("successful case %s returns error: %v", testCase.expression, err)
+			}
+			if val != testCase.expectedResult {
+				t.Fatalf("%f should be equal %f", val, testCase.expectedResult)
+			}
+		})
+	}
+
+	testCasesFail := []struct {
+		name       string
+		expression string
+	}{
+		{name: "only minus", expression: "-"},
+		{name: "trailing unary", expression: "2*-"},
+		{name: "multiplication as unary", expression: "*2"},
+		{name: "multiplication after operator", expression: "2+*3"},
+	}
+
+	for _, testCase := range testCasesFail {
+		t.Run(testCase.name, func(t *testing.T) {
+			val, err := calculation.Calc(testCase.expression)
+			if err == nil {
+				t.Fatalf("expression %s is invalid but result  %f was obtained", testCase.expression, val)
+			}
+		})
+	}
+}
+
+func TestCalcPower(t *testing.T) {
+	testCasesSuccess := []struct {
+		name           string
+		expression     string
+		expectedResult float64
+	}{
+		{name: "simple", expression: "2^10", expectedResult: 1024},
+		{name: "alias", expression: "2**10", expectedResult: 1024},
+		{name: "right associative", expression: "2^3^2", expectedResult: 512},
+		{name: "alias right associative", expression: "2**3**2", expectedResult: 512},
+		{name: "above multiplication", expression: "3*2^2", expectedResult: 12},
+		{name: "above unary minus", expression: "-2^2", expectedResult: -4},
+		{name: "negative base", expression: "(-2)^2", expectedResult: 4},
+		{name: "negative exponent", expression: "2^-1", expectedResult: 0.5},
+		{name: "compound interest", expression: "1000*(1+5/100)^2", expectedResult: 1102.5},
+	}
+
+	for _, testCase := range testCasesSuccess {
+		t.Run(testCase.name, func(t *testing.T) {
+			val, err := calculation.Calc(testCase.expression)
+			if err != nil {
+				t.Fatalf("successful case %s returns error: %v", testCase.expression, err)
+			}
+			if val != testCase.expectedResult {
+				t.Fatalf("%f should be equal %f", val, testCase.expectedResult)
+			}
+		})
+	}
+
+	testCasesFail := []struct {
+		name        string
+		expression  string
+		expectedErr error
+	}{
+		{name: "overflow", expression: "10^400", expectedErr: calculation.ErrOverflow},
+		{name: "multiplication overflow", expression: "10^300*10^300", expectedErr: calculation.ErrOverflow},
+		{name: "root of negative", expression: "(-8)^(1/3)", expectedErr: calculation.ErrNotANumber},
+		{name: "missing exponent", expression: "2^", expectedErr: calculation.ErrInvalidValuesCount},
+	}
+
+	for _, testCase := range testCasesFail {
+		t.Run(testCase.name, func(t *testing.T) {
+			val, err := calculation.Calc(testCase.expression)
+			if !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("expression %s: expected error %v, got %v (result %f)", testCase.expression, testCase.expectedErr, err, val)
+			}
+		})
+	}
+}
+
+func TestCalcFunctions(t *testing.T) {
+	testCasesSuccess := []struct {
+		name           string
+		expression     string
+		expectedResult float64
+	}{
+		{name: "sqrt", expression: "sqrt(16)", expectedResult: 4},
+		{name: "abs", expression: "abs(-3)+1", expectedResult: 4},
+		{name: "min", expression: "min(3, 1, 2)", expectedResult: 1},
+		{name: "max", expression: "max(3, 1+4, 2)", expectedResult: 5},
+		{name: "single argument max", expression: "max(7)", expectedResult: 7},
+		{name: "pow", expression: "pow(2, 10)", expectedResult: 1024},
+		{name: "log10", expression: "log(1000)", expectedResult: 3},
+		{name: "log base", expression: "log(8, 2)", expectedResult: 3},
+		{name: "ln", expression: "ln(1)", expectedResult: 0},
+		{name: "exp", expression: "exp(0)", expectedResult: 1},
+		{name: "trigonometry", expression: "sin(0)+cos(0)+tan(0)", expectedResult: 1},
+		{name: "floor", expression: "floor(2.7)", expectedResult: 2},
+		{name: "ceil", expression: "ceil(2.1)", expectedResult: 3},
+		{name: "round", expression: "round(2.5)", expectedResult: 3},
+		{name: "round digits", expression: "round(3.14159, 2)", expectedResult: 3.14},
+		{name: "nested", expression: "sqrt(abs(-2*8))", expectedResult: 4},
+		{name: "negated call", expression: "-sqrt(4)^2", expectedResult: -4},
+		{name: "precedence", expression: "2*sqrt(9)+1", expectedResult: 7},
+	}
+
+	for _, testCase := range testCasesSuccess {
+		t.Run(testCase.name, func(t *testing.T) {
+			val, err := calculation.Calc(testCase.expression)
+			if err != nil {
+				t.Fatalf("successful case %s returns error: %v", testCase.expression, err)
+			}
+			if val != testCase.expectedResult {
+				t.Fatalf("%f should be equal %f", val, testCase.expectedResult)
+			}
+		})
+	}
+
+	testCasesFail := []struct {
+		name        string
+		expression  string
+		expectedErr error
+	}{
+		{name: "unknown", expression: "foo(1)", expectedErr: calculation.ErrUnknownFunction},
+		{name: "too many", expression: "sqrt(1, 2)", expectedErr: calculation.ErrArity},
+		{name: "too few", expression: "pow(2)", expectedErr: calculation.ErrArity},
+		{name: "no arguments", expression: "min()", expectedErr: calculation.ErrArity},
+		{name: "trailing comma", expression: "max(1,)", expectedErr: calculation.ErrInvalidExpression},
+		{name: "comma outside call", expression: "(1,2)", expectedErr: calculation.ErrInvalidExpression},
+		{name: "unclosed call", expression: "sqrt(4", expectedErr: calculation.ErrInvalidParentheses},
+		{name: "negative root", expression: "sqrt(-1)", expectedErr: calculation.ErrNotANumber},
+	}
+
+	for _, testCase := range testCasesFail {
+		t.Run(testCase.name, func(t *testing.T) {
+			val, err := calculation.Calc(testCase.expression)
+			if !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("expression %s: expected error %v, got %v (result %f)", testCase.expression, testCase.expectedErr, err, val)
+			}
+		})
+	}
+}
+
+func TestRegisterFunction(t *testing.T) {
+	err := calculation.RegisterFunction("vat", calculation.Function{
+		MinArgs: 1,
+		MaxArgs: 1,
+		Call: func(args ...float64) (float64, error) {
+			return args[0] * 1.2, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("register returns error: %v", err)
+	}
+	if val, err := calculation.Calc("vat(100)"); err != nil || val != 120 {
+		t.Fatalf("expected 120, got %f (%v)", val, err)
+	}
+	if val, err := calculation.Call("vat", 50); err != nil || val != 60 {
+		t.Fatalf("expected 60, got %f (%v)", val, err)
+	}
+
+	if err := calculation.RegisterFunction("2bad", calculation.Function{Call: minOfTest}); err == nil {
+		t.Fatal("invalid name must be rejected")
+	}
+	if err := calculation.RegisterFunction("nocall", calculation.Function{}); err == nil {
+		t.Fatal("function without implementation must be rejected")
+	}
+}
+
+func minOfTest(args ...float64) (float64, error) {
+	return args[0], nil
+}
+
+func TestCalcWithVars(t *testing.T) {
+	testCasesSuccess := []struct {
+		name           string
+		expression     string
+		vars           map[string]float64
+		expectedResult float64
+	}{
+		{name: "pi", expression: "round(pi, 2)", expectedResult: 3.14},
+		{name: "e", expression: "ln(e)", expectedResult: 1},
+		{name: "variables", expression: "price * (1 + rate)", vars: map[string]float64{"price": 100, "rate": 0.5}, expectedResult: 150},
+		{name: "negated variable", expression: "-x^2", vars: map[string]float64{"x": 3}, expectedResult: -9},
+		{name: "variable shadows constant", expression: "e * 2", vars: map[string]float64{"e": 10}, expectedResult: 20},
+		{name: "underscore and digits", expression: "item_2 + 1", vars: map[string]float64{"item_2": 1}, expectedResult: 2},
+	}
+
+	for _, testCase := range testCasesSuccess {
+		t.Run(testCase.name, func(t *testing.T) {
+			val, err := calculation.CalcWithVars(testCase.expression, testCase.vars)
+			if err != nil {
+				t.Fatalf("successful case %s returns error: %v", testCase.expression, err)
+			}
+			if val != testCase.expectedResult {
+				t.Fatalf("%f should be equal %f", val, testCase.expectedResult)
+			}
+		})
+	}
+
+	if _, err := calculation.CalcWithVars("x + y", map[string]float64{"x": 1}); !errors.Is(err, calculation.ErrUnknownVariable) {
+		t.Fatalf("expected ErrUnknownVariable, got %v", err)
+	}
+
+	graph, err := calculation.DecomposeWithVars("x * y", map[string]float64{"x": 2, "y": 3})
+	if err != nil {
+		t.Fatalf("decompose returns error: %v", err)
+	}
+	if len(graph.Operations) != 1 || graph.Operations[0].Args[0].Value != 2 || graph.Operations[0].Args[1].Value != 3 {
+		t.Fatalf("variables must be substituted as numbers, got %+v", graph.Operations)
+	}
+}
+
+func TestCalcNumberLiterals(t *testing.T) {
+	testCasesSuccess := []struct {
+		name           string
+		expression     string
+		expectedResult float64
+	}{
+		{name: "decimal", expression: "1.5+1", expectedResult: 2.5},
+		{name: "leading dot", expression: ".5*4", expectedResult: 2},
+		{name: "trailing dot", expression: "5.+1", expectedResult: 6},
+		{name: "exponent", expression: "1e-3*1000", expectedResult: 1},
+		{name: "exponent with plus", expression: "2.5E+2", expectedResult: 250},
+		{name: "underscores", expression: "1_000+1", expectedResult: 1001},
+		{name: "hex", expression: "0x1F", expectedResult: 31},
+		{name: "octal", expression: "0o17", expectedResult: 15},
+		{name: "binary", expression: "0b101", expectedResult: 5},
+		{name: "e constant after number", expression: "2*e-e*2", expectedResult: 0},
+		{name: "exponent minus", expression: "1e2-1", expectedResult: 99},
+	}
+
+	for _, testCase := range testCasesSuccess {
+		t.Run(testCase.name, func(t *testing.T) {
+			val, err := calculation.Calc(testCase.expression)
+			if err != nil {
+				t.Fatalf("successful case %s returns error: %v", testCase.expression, err)
+			}
+			if val != testCase.expectedResult {
+				t.Fatalf("%f should be equal %f", val, testCase.expectedResult)
+			}
+		})
+	}
+
+	testCasesFail := []struct {
+		name        string
+		expression  string
+		token       string
+		expectedErr error
+	}{
+		{name: "two dots", expression: "1.2.3+1", token: "1.2.3", expectedErr: calculation.ErrInvalidNumber},
+		{name: "dot after exponent", expression: "1e5.5", token: "1e5.5", expectedErr: calculation.ErrInvalidNumber},
+		{name: "leading underscore", expression: "1+1__0", token: "1__0", expectedErr: calculation.ErrInvalidNumber},
+		{name: "trailing underscore", expression: "1_", token: "1_", expectedErr: calculation.ErrInvalidNumber},
+		{name: "bad binary digit", expression: "0b102", token: "0b102", expectedErr: calculation.ErrInvalidNumber},
+		{name: "empty hex", expression: "0x", token: "0x", expectedErr: calculation.ErrInvalidNumber},
+		{name: "out of range", expression: "1e400", token: "1e400", expectedErr: calculation.ErrOverflow},
+	}
+
+	for _, testCase := range testCasesFail {
+		t.Run(testCase.name, func(t *testing.T) {
+			val, err := calculation.Calc(testCase.expression)
+			if !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("expression %s: expected error %v, got %v (result %f)", testCase.expression, testCase.expectedErr, err, val)
+			}
+			var parseErr *calculation.ParseError
+			if !errors.As(err, &parseErr) || parseErr.Token != testCase.token {
+				t.Fatalf("expected malformed literal %q in error, got %v", testCase.token, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package calculation
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Rounding — способ округления результата в десятичном режиме
+type Rounding string
+
+const (
+	RoundHalfEven Rounding = "half_even" // к ближайшему, половина — к чётному (банковское)
+	RoundHalfUp   Rounding = "half_up"   // к ближайшему, половина — от нуля
+	RoundHalfDown Rounding = "half_down" // к ближайшему, половина — к нулю
+	RoundUp       Rounding = "up"        // от нуля
+	RoundDown     Rounding = "down"      // к нулю (отбрасывание)
+	RoundCeiling  Rounding = "ceiling"   // к +бесконечности
+	RoundFloor    Rounding = "floor"     // к -бесконечности
+)
+
+// ParseRounding — проверка названия способа округления
+func ParseRounding(name string) (Rounding, error) {
+	switch mode := Rounding(name); mode {
+	case RoundHalfEven, RoundHalfUp, RoundHalfDown, RoundUp, RoundDown, RoundCeiling, RoundFloor:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown rounding mode %q", name)
+}
+
+// MaxScale — наибольшее допустимое число знаков после запятой
+const MaxScale = 100
+
+// Decimal — параметры десятичного режима. Вычисления ведутся точно,
+// в рациональных числах; округляется только итоговый результат.
+type Decimal struct {
+	Scale    int      // наибольшее число знаков после запятой в результате
+	Rounding Rounding // способ округления до Scale знаков
+}
+
+// DefaultDecimal — параметры десятичного режима по умолчанию
+var DefaultDecimal = Decimal{Scale: 10, Rounding: RoundHalfEven}
+
+// Validate — проверка параметров десятичного режима
+func (d Decimal) Validate() error {
+	if d.Scale < 0 || d.Scale > MaxScale {
+		return fmt.Errorf("scale must be between 0 and %d", MaxScale)
+	}
+	_, err := ParseRounding(string(d.Rounding))
+	return err
+}
+
+// Format — запись числа, округлённого до Scale знаков, без завершающих нулей
+func (d Decimal) Format(value *big.Rat) string {
+	text := roundRat(value, d.Scale, d.Rounding).FloatString(d.Scale)
+	if strings.Contains(text, ".") {
+		text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+	}
+	if text == "-0" {
+		return "0"
+	}
+	return text
+}
+
+// CalcDecimal — точное вычисление выражения в десятичном режиме:
+// 0.1+0.2 даёт ровно "0.3". Результат — строка, округлённая по d.
+func CalcDecimal(expression string, vars map[string]float64, d Decimal) (string, error) {
+	root, err := Parse(expression)
+	if err != nil {
+		return "", err
+	}
+	value, err := EvalDecimal(root, vars)
+	if err != nil {
+		return "", err
+	}
+	return d.Format(value), nil
+}
+
+// EvalDecimal — точное значение дерева выражения без округления.
+// Поддерживаются +, -, *, /, ^ с целым показателем и функции, значение
+// которых рационально (abs, min, max, floor, ceil, round, pow); остальные
+// дают ErrDecimalUnsupported. Переменные и константы берутся в кратчайшей
+// десятичной записи их float64-значения: 0.1 — это ровно 1/10.
+func EvalDecimal(node Node, vars map[string]float64) (*big.Rat, error) {
+	switch n := node.(type) {
+	case *Number:
+		if n.Literal != "" {
+			if value, ok := new(big.Rat).SetString(n.Literal); ok {
+				return value, nil
+			}
+		}
+		return ratFromFloat(n.Value)
+
+	case *Ident:
+		val, ok := lookupIdentifier(n.Name, vars)
+		if !ok {
+			return nil, ErrUnknownVariable
+		}
+		return ratFromFloat(val)
+
+	case *Unary:
+		operand, err := EvalDecimal(n.Operand, vars)
+		if err != nil || n.Op == "+" {
+			return operand, err
+		}
+		return operand.Neg(operand), nil
+
+	case *Binary:
+		left, err := EvalDecimal(n.Left, vars)
+		if err != nil {
+			return nil, err
+		}
+		right, err := EvalDecimal(n.Right, vars)
+		if err != nil {
+			return nil, err
+		}
+		return applyDecimal(n.Op, left, right)
+
+	case *FuncCall:
+		if _, err := new(compiler).resolveFunction(n); err != nil {
+			return nil, err
+		}
+		fn, ok := decimalFunctions[n.Name]
+		if !ok {
+			return nil, ErrDecimalUnsupported
+		}
+		args := make([]*big.Rat, len(n.Args))
+		for i, arg := range n.Args {
+			var err error
+			if args[i], err = EvalDecimal(arg, vars); err != nil {
+				return nil, err
+			}
+		}
+		result, err := fn(args...)
+		if err != nil {
+			return nil, err
+		}
+		return checkRat(result)
+	}
+	return nil, ErrInvalidExpression
+}
+
+// EvalDecimal — точное вычисление программы в десятичном режиме
+func (p *Program) EvalDecimal(vars map[string]float64, d Decimal) (string, error) {
+	value, err := EvalDecimal(p.root, vars)
+	if err != nil {
+		return "", err
+	}
+	return d.Format(value), nil
+}
+
+// maxRatBits — предел размера числителя и знаменателя: точные числа растут
+// неограниченно, и 10^10^6 иначе заняло бы всю память
+const maxRatBits = 1 << 16
+
+func applyDecimal(op string, a, b *big.Rat) (*big.Rat, error) {
+	result := new(big.Rat)
+	switch op {
+	case "+":
+		result.Add(a, b)
+	case "-":
+		result.Sub(a, b)
+	case "*":
+		result.Mul(a, b)
+	case "/":
+		if b.Sign() == 0 {
+			return nil, ErrInvalidZero
+		}
+		result.Quo(a, b)
+	case "^":
+		return powRat(a, b)
+	default:
+		return nil, ErrInvalidOperand
+	}
+	return checkRat(result)
+}
+
+// powRat — степень с целым показателем; дробный показатель дал бы иррациональное число
+func powRat(base, exponent *big.Rat) (*big.Rat, error) {
+	if !exponent.IsInt() {
+		return nil, ErrDecimalUnsupported
+	}
+	if !exponent.Num().IsInt64() {
+		return nil, ErrOverflow
+	}
+	n := exponent.Num().Int64()
+	if n < 0 && base.Sign() == 0 {
+		return nil, ErrInvalidZero
+	}
+	abs := n
+	if abs < 0 {
+		abs = -abs
+	}
+	bits := int64(base.Num().BitLen())
+	if denom := int64(base.Denom().BitLen()); denom > bits {
+		bits = denom
+	}
+	if bits > 1 && abs > maxRatBits/bits {
+		return nil, ErrOverflow
+	}
+
+	e := big.NewInt(abs)
+	num := new(big.Int).Exp(base.Num(), e, nil)
+	denom := new(big.Int).Exp(base.Denom(), e, nil)
+	if n < 0 {
+		num, denom = denom, num
+	}
+	return checkRat(new(big.Rat).SetFrac(num, denom))
+}
+
+func checkRat(value *big.Rat) (*big.Rat, error) {
+	if value.Num().BitLen() > maxRatBits || value.Denom().BitLen() > maxRatBits {
+		return nil, ErrOverflow
+	}
+	return value, nil
+}
+
+// ratFromFloat — точное число по кратчайшей десятичной записи float64
+func ratFromFloat(value float64) (*big.Rat, error) {
+	if math.IsNaN(value) {
+		return nil, ErrNotANumber
+	}
+	if math.IsInf(value, 0) {
+		return nil, ErrOverflow
+	}
+	result, _ := new(big.Rat).SetString(strconv.FormatFloat(value, 'g', -1, 64))
+	return result, nil
+}
+
+// roundRat — округление до scale знаков после запятой (scale < 0 — до десятков, сотен...)
+func roundRat(value *big.Rat, scale int, mode Rounding) *big.Rat {
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(absInt(scale))), nil)
+	num := new(big.Int).Set(value.Num())
+	denom := new(big.Int).Set(value.Denom())
+	if scale >= 0 {
+		num.Mul(num, pow)
+	} else {
+		denom.Mul(denom, pow)
+	}
+
+	// value * 10^scale = q + r/denom, q усечено к нулю
+	q, r := new(big.Int).QuoRem(num, denom, new(big.Int))
+	if r.Sign() != 0 {
+		// half > 0 — отброшено больше половины, half == 0 — ровно половина
+		twice := new(big.Int).Abs(r)
+		half := twice.Lsh(twice, 1).Cmp(denom)
+
+		var away bool
+		switch mode {
+		case RoundUp:
+			away = true
+		case RoundDown:
+			away = false
+		case RoundCeiling:
+			away = value.Sign() > 0
+		case RoundFloor:
+			away = value.Sign() < 0
+		case RoundHalfUp:
+			away = half >= 0
+		case RoundHalfDown:
+			away = half > 0
+		default:
+			away = half > 0 || half == 0 && q.Bit(0) == 1
+		}
+		if away {
+			q.Add(q, big.NewInt(int64(value.Sign())))
+		}
+	}
+
+	result := new(big.Rat).SetInt(q)
+	if scale >= 0 {
+		return result.Quo(result, new(big.Rat).SetInt(pow))
+	}
+	return result.Mul(result, new(big.Rat).SetInt(pow))
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// decimalFunctions — функции, точно вычислимые в десятичном режиме.
+// Число аргументов проверяется по основному реестру функций.
+var decimalFunctions = map[string]func(args ...*big.Rat) (*big.Rat, error){
+	"abs": func(args ...*big.Rat) (*big.Rat, error) {
+		return new(big.Rat).Abs(args[0]), nil
+	},
+	"min": func(args ...*big.Rat) (*big.Rat, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) < 0 {
+				result = arg
+			}
+		}
+		return result, nil
+	},
+	"max": func(args ...*big.Rat) (*big.Rat, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) > 0 {
+				result = arg
+			}
+		}
+		return result, nil
+	},
+	"floor": func(args ...*big.Rat) (*big.Rat, error) {
+		return roundRat(args[0], 0, RoundFloor), nil
+	},
+	"ceil": func(args ...*big.Rat) (*big.Rat, error) {
+		return roundRat(args[0], 0, RoundCeiling), nil
+	},
+	"pow": func(args ...*big.Rat) (*big.Rat, error) {
+		return powRat(args[0], args[1])
+	},
+	// round, как и в обычном режиме, округляет половину от нуля
+	"round": func(args ...*big.Rat) (*big.Rat, error) {
+		scale := 0
+		if len(args) == 2 {
+			n := roundRat(args[1], 0, RoundDown)
+			if !n.Num().IsInt64() || absInt(int(n.Num().Int64())) > MaxScale {
+				return nil, ErrOverflow
+			}
+			scale = int(n.Num().Int64())
+		}
+		return roundRat(args[0], scale, RoundHalfUp), nil
+	},
+}
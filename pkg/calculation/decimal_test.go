@@ -0,0 +1,66 @@
+package calculation_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/pkg/calculation"
+)
+
+func TestCalcDecimal(t *testing.T) {
+	testCasesSuccess := []struct {
+		name       string
+		expression string
+		vars       map[string]float64
+		decimal    calculation.Decimal
+		expected   string
+	}{
+		{name: "exact sum", expression: "0.1+0.2", decimal: calculation.DefaultDecimal, expected: "0.3"},
+		{name: "division rounded", expression: "1/3", decimal: calculation.Decimal{Scale: 4, Rounding: calculation.RoundHalfEven}, expected: "0.3333"},
+		{name: "half even down", expression: "0.125", decimal: calculation.Decimal{Scale: 2, Rounding: calculation.RoundHalfEven}, expected: "0.12"},
+		{name: "half even up", expression: "0.135", decimal: calculation.Decimal{Scale: 2, Rounding: calculation.RoundHalfEven}, expected: "0.14"},
+		{name: "half up", expression: "0.125", decimal: calculation.Decimal{Scale: 2, Rounding: calculation.RoundHalfUp}, expected: "0.13"},
+		{name: "half down", expression: "0.125", decimal: calculation.Decimal{Scale: 2, Rounding: calculation.RoundHalfDown}, expected: "0.12"},
+		{name: "up negative", expression: "-2/3", decimal: calculation.Decimal{Scale: 0, Rounding: calculation.RoundUp}, expected: "-1"},
+		{name: "down", expression: "2/3", decimal: calculation.Decimal{Scale: 1, Rounding: calculation.RoundDown}, expected: "0.6"},
+		{name: "ceiling", expression: "-2/3", decimal: calculation.Decimal{Scale: 0, Rounding: calculation.RoundCeiling}, expected: "0"},
+		{name: "floor", expression: "-1/3", decimal: calculation.Decimal{Scale: 1, Rounding: calculation.RoundFloor}, expected: "-0.4"},
+		{name: "large integers", expression: "12345678901234567890*10+1", decimal: calculation.DefaultDecimal, expected: "123456789012345678901"},
+		{name: "integer power", expression: "1.1^2-2^-1", decimal: calculation.DefaultDecimal, expected: "0.71"},
+		{name: "variables", expression: "price*qty", vars: map[string]float64{"price": 0.1, "qty": 3}, decimal: calculation.DefaultDecimal, expected: "0.3"},
+		{name: "functions", expression: "round(2.675, 2)+max(0.1, 0.2)+abs(-1)+floor(1.5)", decimal: calculation.DefaultDecimal, expected: "4.88"},
+	}
+
+	for _, testCase := range testCasesSuccess {
+		t.Run(testCase.name, func(t *testing.T) {
+			val, err := calculation.CalcDecimal(testCase.expression, testCase.vars, testCase.decimal)
+			if err != nil {
+				t.Fatalf("successful case %s returns error: %v", testCase.expression, err)
+			}
+			if val != testCase.expected {
+				t.Fatalf("%s should be equal %s", val, testCase.expected)
+			}
+		})
+	}
+
+	testCasesFail := []struct {
+		name        string
+		expression  string
+		expectedErr error
+	}{
+		{name: "division by zero", expression: "1/(0.1-0.1)", expectedErr: calculation.ErrInvalidZero},
+		{name: "fractional power", expression: "2^0.5", expectedErr: calculation.ErrDecimalUnsupported},
+		{name: "irrational function", expression: "sqrt(2)", expectedErr: calculation.ErrDecimalUnsupported},
+		{name: "huge power", expression: "10^1000000", expectedErr: calculation.ErrOverflow},
+		{name: "unknown function", expression: "foo(1)", expectedErr: calculation.ErrUnknownFunction},
+	}
+
+	for _, testCase := range testCasesFail {
+		t.Run(testCase.name, func(t *testing.T) {
+			val, err := calculation.CalcDecimal(testCase.expression, nil, calculation.DefaultDecimal)
+			if !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("expression %s: expected error %v, got %v (result %s)", testCase.expression, testCase.expectedErr, err, val)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package calculation
+
+// Operand — аргумент операции: либо готовое число, либо результат другой операции графа
+type Operand struct {
+	Const bool    // true, если операнд — число из выражения
+	Value float64 // значение числа (при Const)
+	Ref   int     // индекс операции-источника в Graph.Operations (при !Const)
+}
+
+// Operation — одна операция графа: бинарный оператор (Args[0] Operation Args[1])
+// либо вызов функции Operation(Args...); различаются через IsOperator
+type Operation struct {
+	Operation string
+	Args      []Operand
+}
+
+// Graph — выражение, разложенное на зависимые операции.
+// Операции упорядочены так, что каждая ссылается только на предыдущие.
+// Root — итоговое значение: ссылка на последнюю операцию либо число,
+// если выражение состоит из одного числа.
+type Graph struct {
+	Operations []Operation
+	Root       Operand
+}
+
+// Decompose — разбор выражения в граф операций для распределённого вычисления
+func Decompose(expression string) (*Graph, error) {
+	return DecomposeWithVars(expression, nil)
+}
+
+// DecomposeWithVars — разбор выражения с переменными: их значения,
+// как и константы, подставляются в граф сразу как числа
+func DecomposeWithVars(expression string, vars map[string]float64) (*Graph, error) {
+	root, err := Parse(expression)
+	if err != nil {
+		return nil, err
+	}
+	return DecomposeNode(root, vars)
+}
+
+// DecomposeNode — раскладка уже разобранного дерева в граф операций
+func DecomposeNode(root Node, vars map[string]float64) (*Graph, error) {
+	d := decomposer{graph: &Graph{}, vars: vars}
+	operand, err := d.decompose(root)
+	if err != nil {
+		return nil, err
+	}
+	d.graph.Root = operand
+	return d.graph, nil
+}
+
+// decomposer — сборка графа операций обходом дерева в глубину,
+// поэтому операции-аргументы всегда оказываются раньше зависимых
+type decomposer struct {
+	graph *Graph
+	vars  map[string]float64
+}
+
+func (d decomposer) decompose(node Node) (Operand, error) {
+	switch n := node.(type) {
+	case *Number:
+		return Operand{Const: true, Value: n.Value}, nil
+
+	case *Ident:
+		val, ok := lookupIdentifier(n.Name, d.vars)
+		if !ok {
+			return Operand{}, ErrUnknownVariable
+		}
+		return Operand{Const: true, Value: val}, nil
+
+	case *Unary:
+		operand, err := d.decompose(n.Operand)
+		if err != nil || n.Op == "+" {
+			return operand, err
+		}
+		// Число сворачивается сразу, минус от результата операции
+		// становится бинарной операцией 0 - x
+		if operand.Const {
+			return Operand{Const: true, Value: -operand.Value}, nil
+		}
+		return d.add("-", []Operand{{Const: true}, operand}), nil
+
+	case *Binary:
+		if !IsOperator(n.Op) {
+			return Operand{}, ErrInvalidOperand
+		}
+		left, err := d.decompose(n.Left)
+		if err != nil {
+			return Operand{}, err
+		}
+		right, err := d.decompose(n.Right)
+		if err != nil {
+			return Operand{}, err
+		}
+		return d.add(n.Op, []Operand{left, right}), nil
+
+	case *FuncCall:
+		if _, err := new(compiler).resolveFunction(n); err != nil {
+			return Operand{}, err
+		}
+		args := make([]Operand, len(n.Args))
+		for i, arg := range n.Args {
+			var err error
+			if args[i], err = d.decompose(arg); err != nil {
+				return Operand{}, err
+			}
+		}
+		return d.add(n.Name, args), nil
+	}
+	return Operand{}, ErrInvalidExpression
+}
+
+// add — добавление операции в граф и ссылка на её результат
+func (d decomposer) add(op string, args []Operand) Operand {
+	d.graph.Operations = append(d.graph.Operations, Operation{
+		Operation: op,
+		Args:      args,
+	})
+	return Operand{Ref: len(d.graph.Operations) - 1}
+}
@@ -1,6 +1,10 @@
 package calculation
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var (
 	ErrInvalidExpression  = errors.New("invalid expression")
@@ -9,4 +13,97 @@ var (
 	ErrInvalidOperand     = errors.New("unknown operand")
 	ErrInvalidValuesCount = errors.New("invalid number of values")
 	ErrInvalidCalculation = errors.New("invalid calculation")
+	ErrOverflow           = errors.New("result is out of range")
+	ErrNotANumber         = errors.New("result is not a real number")
+	ErrUnknownFunction    = errors.New("unknown function")
+	ErrArity              = errors.New("wrong number of function arguments")
+	ErrUnknownVariable    = errors.New("unknown variable")
+	ErrInvalidNumber      = errors.New("malformed number")
+	ErrDecimalUnsupported = errors.New("operation is not supported in decimal mode")
 )
+
+// ParseError — синтаксическая ошибка с позицией. errors.Is сопоставляет её
+// с исходной ошибкой (ErrInvalidExpression, ErrInvalidParentheses, ...).
+type ParseError struct {
+	Expression string   // исходное выражение
+	Offset     int      // байтовое смещение ошибки в Expression
+	Token      string   // токен на месте ошибки; "" — конец выражения
+	Expected   []string // что допустимо на этом месте
+	Err        error
+}
+
+func (e *ParseError) Error() string {
+	token := "end of expression"
+	if e.Token != "" {
+		token = fmt.Sprintf("%q", e.Token)
+	}
+	msg := fmt.Sprintf("%v at offset %d: unexpected %s", e.Err, e.Offset, token)
+	if len(e.Expected) > 0 {
+		msg += ", expected " + strings.Join(e.Expected, ", ")
+	}
+	return msg
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Caret — выражение и строка с ^ под местом ошибки
+func (e *ParseError) Caret() string {
+	// Отступ по символам, а не байтам; табуляции сохраняем, чтобы ^ не съехал
+	var pad strings.Builder
+	for _, r := range e.Expression[:e.Offset] {
+		if r == '\t' {
+			pad.WriteByte('\t')
+		} else {
+			pad.WriteByte(' ')
+		}
+	}
+	return e.Expression + "\n" + pad.String() + "^"
+}
+
+// CodeInternal — код для ошибок, не относящихся к пакету calculation
+const CodeInternal = "internal_error"
+
+// errorCodes — машиночитаемые коды ошибок для API и обмена с агентами
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrInvalidExpression, "invalid_expression"},
+	{ErrInvalidParentheses, "invalid_parentheses"},
+	{ErrInvalidZero, "division_by_zero"},
+	{ErrInvalidOperand, "unknown_operator"},
+	{ErrInvalidValuesCount, "invalid_values_count"},
+	{ErrInvalidCalculation, "invalid_character"},
+	{ErrOverflow, "overflow"},
+	{ErrNotANumber, "not_a_number"},
+	{ErrUnknownFunction, "unknown_function"},
+	{ErrArity, "wrong_arity"},
+	{ErrUnknownVariable, "unknown_variable"},
+	{ErrInvalidNumber, "invalid_number"},
+	{ErrDecimalUnsupported, "decimal_unsupported"},
+}
+
+// Code — код ошибки вычисления: "" для nil, CodeInternal для чужих ошибок
+func Code(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return CodeInternal
+}
+
+// FromCode — ошибка пакета по её коду; nil, если код неизвестен
+func FromCode(code string) error {
+	for _, c := range errorCodes {
+		if c.code == code {
+			return c.err
+		}
+	}
+	return nil
+}
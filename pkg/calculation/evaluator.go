@@ -0,0 +1,147 @@
+package calculation
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Evaluator — вычислитель выражений. Агенты и встроенные исполнители
+// считают им отдельные операции (см. EvaluateOperation); выражения целиком
+// сервер проверяет и разбирает собственным разборщиком (Native).
+type Evaluator interface {
+	// Validate — проверка синтаксиса, функций и числа их аргументов без вычисления
+	Validate(expression string) error
+	// Evaluate — вычисление выражения с переменными
+	Evaluate(expression string, vars map[string]float64) (float64, error)
+}
+
+// Native — вычислитель на собственном разборщике пакета
+type Native struct {
+	Options Options // расширения синтаксиса
+}
+
+func (n Native) Validate(expression string) error {
+	_, err := n.compile(expression)
+	return err
+}
+
+// ValidateWithVars — Validate и проверка, что каждое имя в выражении —
+// переменная из vars или встроенная константа. Первое неизвестное имя
+// возвращается как *ParseError с его позицией.
+func (n Native) ValidateWithVars(expression string, vars map[string]float64) error {
+	program, err := n.compile(expression)
+	if err != nil {
+		return err
+	}
+	var unknown *Ident
+	Inspect(program.Node(), func(node Node) bool {
+		if unknown != nil {
+			return false
+		}
+		if ident, ok := node.(*Ident); ok {
+			if _, ok := lookupIdentifier(ident.Name, vars); !ok {
+				unknown = ident
+			}
+		}
+		return true
+	})
+	if unknown == nil {
+		return nil
+	}
+	c := &compiler{source: expression}
+	return c.fail(ErrUnknownVariable, unknown.Name, unknown.Pos, identifierNames(vars))
+}
+
+func (n Native) Evaluate(expression string, vars map[string]float64) (float64, error) {
+	program, err := n.compile(expression)
+	if err != nil {
+		return 0, err
+	}
+	return program.Eval(vars)
+}
+
+func (n Native) compile(expression string) (*Program, error) {
+	root, err := ParseWithOptions(expression, n.Options)
+	if err != nil {
+		return nil, err
+	}
+	return compileSource(root, expression)
+}
+
+// DefaultEvaluator — имя вычислителя по умолчанию
+const DefaultEvaluator = "native"
+
+var (
+	evaluatorsMu sync.RWMutex
+	evaluators   = map[string]Evaluator{
+		DefaultEvaluator: Native{},
+		"govaluate":      Govaluate{},
+	}
+)
+
+// RegisterEvaluator — добавление вычислителя (или замена встроенного)
+func RegisterEvaluator(name string, evaluator Evaluator) error {
+	if name == "" {
+		return fmt.Errorf("empty evaluator name")
+	}
+	if evaluator == nil {
+		return fmt.Errorf("evaluator %q has no implementation", name)
+	}
+
+	evaluatorsMu.Lock()
+	defer evaluatorsMu.Unlock()
+	evaluators[name] = evaluator
+	return nil
+}
+
+// LookupEvaluator — вычислитель по имени; пустое имя — DefaultEvaluator
+func LookupEvaluator(name string) (Evaluator, error) {
+	if name == "" {
+		name = DefaultEvaluator
+	}
+
+	evaluatorsMu.RLock()
+	defer evaluatorsMu.RUnlock()
+	evaluator, ok := evaluators[name]
+	if !ok {
+		names := make([]string, 0, len(evaluators))
+		for name := range evaluators {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown evaluator %q, expected one of: %s", name, strings.Join(names, ", "))
+	}
+	return evaluator, nil
+}
+
+// EvaluateOperation — вычисление одной операции графа: оператора над
+// args[0] и args[1] либо вызова функции op(args...). Аргументы передаются
+// переменными, а не текстом, чтобы не терять точность и не зависеть
+// от того, как вычислитель читает отрицательные числа.
+func EvaluateOperation(evaluator Evaluator, op string, args ...float64) (float64, error) {
+	vars := make(map[string]float64, len(args))
+	names := make([]string, len(args))
+	for i, arg := range args {
+		names[i] = "x" + strconv.Itoa(i)
+		vars[names[i]] = arg
+	}
+
+	if IsOperator(op) {
+		if len(args) != 2 {
+			return 0, ErrInvalidValuesCount
+		}
+		// Не все вычислители считают деление на ноль ошибкой: govaluate
+		// даёт бесконечность, которая превратилась бы в ErrOverflow
+		if op == "/" && args[1] == 0 {
+			return 0, ErrInvalidZero
+		}
+		return evaluator.Evaluate(names[0]+op+names[1], vars)
+	}
+	if !isIdentifier(op) {
+		return 0, ErrUnknownFunction
+	}
+	return evaluator.Evaluate(op+"("+strings.Join(names, ",")+")", vars)
+}
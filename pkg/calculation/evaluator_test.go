@@ -0,0 +1,126 @@
+package calculation_test
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Powdersumm/Yandexlmsfinalproject/pkg/calculation"
+)
+
+// corpusCase — строка testdata/evaluator_corpus.txt
+type corpusCase struct {
+	line       int
+	expression string
+	differs    string // причина известного расхождения с Native
+}
+
+func readCorpus(t *testing.T) []corpusCase {
+	file, err := os.Open("testdata/evaluator_corpus.txt")
+	if err != nil {
+		t.Fatalf("open corpus: %v", err)
+	}
+	defer file.Close()
+
+	var cases []corpusCase
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		expression, differs, _ := strings.Cut(text, " # differs: ")
+		cases = append(cases, corpusCase{line: line, expression: expression, differs: differs})
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("read corpus: %v", err)
+	}
+	return cases
+}
+
+// sameOutcome — одинаковы ли результаты: оба успешны с равными числами
+// либо оба ошибочны с одним кодом ошибки
+func sameOutcome(a float64, errA error, b float64, errB error) bool {
+	if errA != nil || errB != nil {
+		return errA != nil && errB != nil && calculation.Code(errA) == calculation.Code(errB)
+	}
+	return a == b || math.Abs(a-b) <= 1e-9*math.Max(math.Abs(a), math.Abs(b))
+}
+
+func TestEvaluatorsAgree(t *testing.T) {
+	vars := map[string]float64{"x": 2, "y": 0.5}
+	native := calculation.Native{}
+	backend := calculation.Govaluate{}
+
+	for _, c := range readCorpus(t) {
+		want, wantErr := native.Evaluate(c.expression, vars)
+		got, gotErr := backend.Evaluate(c.expression, vars)
+		same := sameOutcome(want, wantErr, got, gotErr)
+
+		if !same && c.differs == "" {
+			t.Errorf("line %d: %q: native = %v (%v), govaluate = %v (%v)",
+				c.line, c.expression, want, wantErr, got, gotErr)
+		}
+		if same && c.differs != "" {
+			t.Errorf("line %d: %q now agrees, remove the differs note (%s)", c.line, c.expression, c.differs)
+		}
+	}
+}
+
+func TestEvaluateOperation(t *testing.T) {
+	testCases := []struct {
+		op       string
+		args     []float64
+		expected float64
+	}{
+		{op: "+", args: []float64{2, -3}, expected: -1},
+		{op: "-", args: []float64{2, -3}, expected: 5},
+		{op: "*", args: []float64{-2, -3}, expected: 6},
+		{op: "/", args: []float64{1, 4}, expected: 0.25},
+		{op: "^", args: []float64{-2, 3}, expected: -8},
+		{op: "max", args: []float64{1, 5, 3}, expected: 5},
+		{op: "sqrt", args: []float64{0.25}, expected: 0.5},
+	}
+
+	for _, name := range []string{"native", "govaluate"} {
+		evaluator, err := calculation.LookupEvaluator(name)
+		if err != nil {
+			t.Fatalf("lookup %s: %v", name, err)
+		}
+		for _, testCase := range testCases {
+			val, err := calculation.EvaluateOperation(evaluator, testCase.op, testCase.args...)
+			if err != nil {
+				t.Fatalf("%s: %s%v returns error: %v", name, testCase.op, testCase.args, err)
+			}
+			if val != testCase.expected {
+				t.Fatalf("%s: %s%v = %f, expected %f", name, testCase.op, testCase.args, val, testCase.expected)
+			}
+		}
+	}
+
+	errorCases := []struct {
+		op   string
+		args []float64
+		err  error
+	}{
+		{op: "/", args: []float64{2, 0}, err: calculation.ErrInvalidZero},
+		{op: "/", args: []float64{0, 0}, err: calculation.ErrInvalidZero},
+		{op: "/", args: []float64{-2, math.Copysign(0, -1)}, err: calculation.ErrInvalidZero},
+	}
+	for _, name := range []string{"native", "govaluate"} {
+		evaluator, _ := calculation.LookupEvaluator(name)
+		for _, testCase := range errorCases {
+			_, err := calculation.EvaluateOperation(evaluator, testCase.op, testCase.args...)
+			if !errors.Is(err, testCase.err) {
+				t.Fatalf("%s: %s%v: expected %v, got %v", name, testCase.op, testCase.args, testCase.err, err)
+			}
+		}
+	}
+
+	if _, err := calculation.LookupEvaluator("unknown"); err == nil {
+		t.Fatalf("unknown evaluator was found")
+	}
+}
@@ -0,0 +1,153 @@
+package calculation
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Function — функция, вызываемая в выражении как name(arg1, arg2, ...)
+type Function struct {
+	MinArgs int // минимальное число аргументов
+	MaxArgs int // максимальное число аргументов; -1 — без ограничения
+	Call    func(args ...float64) (float64, error)
+}
+
+var (
+	functionsMu sync.RWMutex
+	functions   = map[string]Function{
+		"sqrt":  oneArg(math.Sqrt),
+		"abs":   oneArg(math.Abs),
+		"ln":    oneArg(math.Log),
+		"exp":   oneArg(math.Exp),
+		"sin":   oneArg(math.Sin),
+		"cos":   oneArg(math.Cos),
+		"tan":   oneArg(math.Tan),
+		"floor": oneArg(math.Floor),
+		"ceil":  oneArg(math.Ceil),
+		"min":   {MinArgs: 1, MaxArgs: -1, Call: minOf},
+		"max":   {MinArgs: 1, MaxArgs: -1, Call: maxOf},
+		"pow": {MinArgs: 2, MaxArgs: 2, Call: func(args ...float64) (float64, error) {
+			return math.Pow(args[0], args[1]), nil
+		}},
+		// log(x) — десятичный логарифм, log(x, b) — по основанию b
+		"log": {MinArgs: 1, MaxArgs: 2, Call: func(args ...float64) (float64, error) {
+			if len(args) == 2 {
+				return math.Log(args[0]) / math.Log(args[1]), nil
+			}
+			return math.Log10(args[0]), nil
+		}},
+		// round(x) — до целого, round(x, n) — до n знаков после запятой
+		"round": {MinArgs: 1, MaxArgs: 2, Call: func(args ...float64) (float64, error) {
+			if len(args) == 2 {
+				scale := math.Pow(10, math.Trunc(args[1]))
+				return math.Round(args[0]*scale) / scale, nil
+			}
+			return math.Round(args[0]), nil
+		}},
+	}
+)
+
+// RegisterFunction — добавление функции в выражения (или замена встроенной).
+// Имя должно быть идентификатором: буква или _, затем буквы, цифры и _.
+func RegisterFunction(name string, fn Function) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("invalid function name %q", name)
+	}
+	if fn.Call == nil {
+		return fmt.Errorf("function %q has no implementation", name)
+	}
+	if fn.MinArgs < 0 || fn.MaxArgs >= 0 && fn.MaxArgs < fn.MinArgs {
+		return fmt.Errorf("function %q has invalid arity", name)
+	}
+
+	functionsMu.Lock()
+	defer functionsMu.Unlock()
+	functions[name] = fn
+	return nil
+}
+
+// LookupFunction — поиск зарегистрированной функции
+func LookupFunction(name string) (Function, bool) {
+	functionsMu.RLock()
+	defer functionsMu.RUnlock()
+	fn, ok := functions[name]
+	return fn, ok
+}
+
+// functionNames — имена зарегистрированных функций по алфавиту
+func functionNames() []string {
+	functionsMu.RLock()
+	defer functionsMu.RUnlock()
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Call — вызов зарегистрированной функции с проверкой числа аргументов
+func Call(name string, args ...float64) (float64, error) {
+	fn, ok := LookupFunction(name)
+	if !ok {
+		return 0, ErrUnknownFunction
+	}
+	return callFunction(fn, args)
+}
+
+func callFunction(fn Function, args []float64) (float64, error) {
+	if !fn.accepts(len(args)) {
+		return 0, ErrArity
+	}
+	result, err := fn.Call(args...)
+	if err != nil {
+		return 0, err
+	}
+	return checkResult(result)
+}
+
+// accepts — допустимо ли такое число аргументов
+func (fn Function) accepts(n int) bool {
+	return n >= fn.MinArgs && (fn.MaxArgs < 0 || n <= fn.MaxArgs)
+}
+
+// arity — допустимое число аргументов словами, для сообщений об ошибках
+func (fn Function) arity() string {
+	count := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%d arguments", n)
+	}
+	switch {
+	case fn.MaxArgs < 0:
+		return "at least " + count(fn.MinArgs)
+	case fn.MinArgs == fn.MaxArgs:
+		return count(fn.MinArgs)
+	}
+	return fmt.Sprintf("%d to %d arguments", fn.MinArgs, fn.MaxArgs)
+}
+
+func oneArg(f func(float64) float64) Function {
+	return Function{MinArgs: 1, MaxArgs: 1, Call: func(args ...float64) (float64, error) {
+		return f(args[0]), nil
+	}}
+}
+
+func minOf(args ...float64) (float64, error) {
+	result := args[0]
+	for _, arg := range args[1:] {
+		result = math.Min(result, arg)
+	}
+	return result, nil
+}
+
+func maxOf(args ...float64) (float64, error) {
+	result := args[0]
+	for _, arg := range args[1:] {
+		result = math.Max(result, arg)
+	}
+	return result, nil
+}
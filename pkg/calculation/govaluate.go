@@ -0,0 +1,95 @@
+package calculation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+)
+
+// Govaluate — вычислитель на github.com/Knetic/govaluate, приведённый к языку
+// пакета: ^ — степень (а не XOR), доступны константы и зарегистрированные
+// функции, ошибки сопоставлены с ErrXxx. Оставшиеся расхождения с Native
+// перечислены в testdata/evaluator_corpus.txt.
+type Govaluate struct{}
+
+func (Govaluate) Validate(expression string) error {
+	_, err := govaluateParse(expression)
+	return err
+}
+
+func (Govaluate) Evaluate(expression string, vars map[string]float64) (float64, error) {
+	parsed, err := govaluateParse(expression)
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := parsed.Eval(govaluateParameters(vars))
+	if err != nil {
+		return 0, err
+	}
+	// Сравнения, логика и строки в языке калькулятора не существуют
+	result, ok := value.(float64)
+	if !ok {
+		return 0, fmt.Errorf("%w: result is %T, not a number", ErrInvalidExpression, value)
+	}
+	return checkResult(result)
+}
+
+func govaluateParse(expression string) (*govaluate.EvaluableExpression, error) {
+	parsed, err := govaluate.NewEvaluableExpressionWithFunctions(
+		strings.ReplaceAll(expression, "^", "**"), govaluateFunctions())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", govaluateParseError(err.Error()), err)
+	}
+	return parsed, nil
+}
+
+// govaluateParseError — сопоставление текста ошибки разбора govaluate с ErrXxx
+func govaluateParseError(message string) error {
+	switch {
+	case strings.Contains(message, "Unbalanced parenthesis"):
+		return ErrInvalidParentheses
+	case strings.HasPrefix(message, "Undefined function"):
+		return ErrUnknownFunction
+	case strings.Contains(message, "Unexpected end of expression"):
+		return ErrInvalidValuesCount
+	case strings.HasPrefix(message, "Unable to parse numeric value"):
+		return ErrInvalidNumber
+	}
+	return ErrInvalidExpression
+}
+
+// govaluateParameters — переменные, а за ними константы
+type govaluateParameters map[string]float64
+
+func (p govaluateParameters) Get(name string) (interface{}, error) {
+	val, ok := lookupIdentifier(name, p)
+	if !ok {
+		return nil, ErrUnknownVariable
+	}
+	return val, nil
+}
+
+// govaluateFunctions — зарегистрированные функции в виде функций govaluate
+func govaluateFunctions() map[string]govaluate.ExpressionFunction {
+	functionsMu.RLock()
+	defer functionsMu.RUnlock()
+
+	result := make(map[string]govaluate.ExpressionFunction, len(functions))
+	for name, fn := range functions {
+		fn := fn
+		result[name] = func(args ...interface{}) (interface{}, error) {
+			values := make([]float64, len(args))
+			for i, arg := range args {
+				val, ok := arg.(float64)
+				if !ok {
+					return nil, ErrInvalidOperand
+				}
+				values[i] = val
+			}
+			return callFunction(fn, values)
+		}
+	}
+	return result
+}
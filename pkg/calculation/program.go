@@ -0,0 +1,165 @@
+package calculation
+
+// Program — скомпилированное выражение: разбор, поиск функций и проверка
+// числа аргументов выполнены один раз, Eval можно вызывать многократно
+type Program struct {
+	root Node
+	eval evalFunc
+}
+
+type evalFunc func(vars map[string]float64) (float64, error)
+
+// Compile — разбор и компиляция выражения. Неизвестная функция и неверное
+// число аргументов возвращаются как *ParseError с позицией имени функции.
+func Compile(expression string) (*Program, error) {
+	root, err := Parse(expression)
+	if err != nil {
+		return nil, err
+	}
+	return compileSource(root, expression)
+}
+
+// CompileNode — компиляция уже разобранного дерева. Исходной строки нет,
+// поэтому ошибки возвращаются без позиции.
+func CompileNode(root Node) (*Program, error) {
+	return compileSource(root, "")
+}
+
+// compileSource — компиляция дерева, разобранного из source
+func compileSource(root Node, source string) (*Program, error) {
+	c := &compiler{source: source}
+	eval, err := c.compile(root)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{root: root, eval: eval}, nil
+}
+
+// Eval — вычисление с переменными. Переменные перекрывают одноимённые константы.
+func (p *Program) Eval(vars map[string]float64) (float64, error) {
+	return p.eval(vars)
+}
+
+// Node — дерево, из которого собрана программа
+func (p *Program) Node() Node {
+	return p.root
+}
+
+// String — запись выражения программы
+func (p *Program) String() string {
+	return p.root.String()
+}
+
+// compiler — состояние компиляции, нужное для построения ParseError
+type compiler struct {
+	source string // исходное выражение; "" — дерево собрано не разбором
+}
+
+// fail — ошибка на имени name со смещением pos. Позиция сообщается, только
+// если имя действительно стоит на этом месте исходной строки.
+func (c *compiler) fail(err error, name string, pos int, expected []string) error {
+	if pos < 0 || pos+len(name) > len(c.source) || c.source[pos:pos+len(name)] != name {
+		return err
+	}
+	return &ParseError{
+		Expression: c.source,
+		Offset:     pos,
+		Token:      name,
+		Expected:   expected,
+		Err:        err,
+	}
+}
+
+func (c *compiler) compile(node Node) (evalFunc, error) {
+	switch n := node.(type) {
+	case *Number:
+		val := n.Value
+		return func(map[string]float64) (float64, error) {
+			return val, nil
+		}, nil
+
+	case *Ident:
+		name := n.Name
+		return func(vars map[string]float64) (float64, error) {
+			val, ok := lookupIdentifier(name, vars)
+			if !ok {
+				return 0, ErrUnknownVariable
+			}
+			return val, nil
+		}, nil
+
+	case *Unary:
+		operand, err := c.compile(n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		if n.Op == "+" {
+			return operand, nil
+		}
+		return func(vars map[string]float64) (float64, error) {
+			val, err := operand(vars)
+			return -val, err
+		}, nil
+
+	case *Binary:
+		if !IsOperator(n.Op) {
+			return nil, ErrInvalidOperand
+		}
+		left, err := c.compile(n.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := c.compile(n.Right)
+		if err != nil {
+			return nil, err
+		}
+		op := n.Op
+		return func(vars map[string]float64) (float64, error) {
+			a, err := left(vars)
+			if err != nil {
+				return 0, err
+			}
+			b, err := right(vars)
+			if err != nil {
+				return 0, err
+			}
+			return Apply(op, a, b)
+		}, nil
+
+	case *FuncCall:
+		fn, err := c.resolveFunction(n)
+		if err != nil {
+			return nil, err
+		}
+		args := make([]evalFunc, len(n.Args))
+		for i, arg := range n.Args {
+			if args[i], err = c.compile(arg); err != nil {
+				return nil, err
+			}
+		}
+		return func(vars map[string]float64) (float64, error) {
+			values := make([]float64, len(args))
+			for i, arg := range args {
+				val, err := arg(vars)
+				if err != nil {
+					return 0, err
+				}
+				values[i] = val
+			}
+			return callFunction(fn, values)
+		}, nil
+	}
+	return nil, ErrInvalidExpression
+}
+
+// resolveFunction — поиск функции вызова и проверка числа аргументов
+func (c *compiler) resolveFunction(n *FuncCall) (Function, error) {
+	fn, ok := LookupFunction(n.Name)
+	if !ok {
+		return Function{}, c.fail(ErrUnknownFunction, n.Name, n.Pos, functionNames())
+	}
+	if !fn.accepts(len(n.Args)) {
+		return Function{}, c.fail(ErrArity, n.Name, n.Pos, []string{fn.arity()})
+	}
+	return fn, nil
+}
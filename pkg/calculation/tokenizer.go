@@ -0,0 +1,87 @@
+package calculation
+
+import "unicode/utf8"
+
+// tokenKind — вид токена выражения
+type tokenKind int
+
+const (
+	tokenNumber   tokenKind = iota
+	tokenIdent              // имя переменной, константы или функции
+	tokenOperator           // + - * / ^ **
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenInvalid // символ, не входящий в язык; ошибку сообщает разбор
+	tokenEnd
+)
+
+// token — лексема выражения с позицией в исходной строке
+type token struct {
+	kind  tokenKind
+	text  string  // запись токена в выражении
+	pos   int     // байтовое смещение в исходной строке
+	value float64 // значение числа (tokenNumber)
+}
+
+// tokenize — разбиение выражения на токены. Пробельные символы только
+// разделяют токены: "12 34" — два числа подряд, а не 1234, и разбор
+// сообщит об ошибке. Последний токен всегда tokenEnd.
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expression); {
+		char := expression[i]
+		switch {
+		case isSpace(char):
+			i++
+			continue
+
+		case isNumberStart(expression, i):
+			val, next, err := searchnumbers(expression, i)
+			if err != nil {
+				return nil, &ParseError{
+					Expression: expression,
+					Offset:     i,
+					Token:      expression[i:next],
+					Expected:   []string{"number"},
+					Err:        err,
+				}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: expression[i:next], pos: i, value: val})
+			i = next
+
+		case isLetter(char):
+			name, next := searchidentifier(expression, i)
+			tokens = append(tokens, token{kind: tokenIdent, text: name, pos: i})
+			i = next
+
+		case char == '*' && i+1 < len(expression) && expression[i+1] == '*':
+			// ** — синоним ^
+			tokens = append(tokens, token{kind: tokenOperator, text: "**", pos: i})
+			i += 2
+
+		default:
+			kind, size := tokenInvalid, 1
+			switch {
+			case isOperator(char):
+				kind = tokenOperator
+			case char == '(':
+				kind = tokenLParen
+			case char == ')':
+				kind = tokenRParen
+			case char == ',':
+				kind = tokenComma
+			default:
+				// Недопустимый символ показываем целиком, а не первым байтом
+				_, size = utf8.DecodeRuneInString(expression[i:])
+			}
+			tokens = append(tokens, token{kind: kind, text: expression[i : i+size], pos: i})
+			i += size
+		}
+	}
+	return append(tokens, token{kind: tokenEnd, pos: len(expression)}), nil
+}
+
+func isSpace(char byte) bool {
+	return char == ' ' || char == '\t' || char == '\n' || char == '\r'
+}